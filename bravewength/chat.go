@@ -0,0 +1,57 @@
+package bravewength
+
+import (
+	"errors"
+
+	"github.com/samclaus/games"
+	"github.com/samclaus/games/protocol"
+)
+
+// Chat channels for each team, which the team's seekers use to talk over the clue, and
+// one for the two knowers. While a game is in progress, knowers may read their team's
+// channel but not post to it, and may not message anybody but the other knower
+// directly, so that they can't give their seekers extra hints.
+const (
+	channelTeal    = "teal"
+	channelPurple  = "purple"
+	channelKnowers = "knowers"
+)
+
+func (g *gameState) ChatChannels(player *games.Client) []protocol.Channel {
+	r := g.roles[player.ID]
+
+	var channels []protocol.Channel
+	switch r.Team() {
+	case teamTeal:
+		channels = append(channels, protocol.Channel{ID: channelTeal, CanPost: g.gameEnded || r.IsSeeker()})
+	case teamPurple:
+		channels = append(channels, protocol.Channel{ID: channelPurple, CanPost: g.gameEnded || r.IsSeeker()})
+	}
+	if r.IsKnower() {
+		channels = append(channels, protocol.Channel{ID: channelKnowers, CanPost: true})
+	}
+
+	return channels
+}
+
+func (g *gameState) CanMessageDirectly(from, to *games.Client) bool {
+	return g.gameEnded || !g.roles[from.ID].IsKnower() || g.roles[to.ID].IsKnower()
+}
+
+var errShuffleInProgress = errors.New("can't shuffle the teams once a game is under way")
+
+func (g *gameState) ChatCommands() []games.ChatCommand {
+	return []games.ChatCommand{
+		{Name: "teams", Help: "shuffle everyone on a team onto random teams", Run: g.teamsCommand},
+	}
+}
+
+func (g *gameState) teamsCommand(players []*games.Client, src *games.Client, _ []string) (string, error) {
+	if !g.canShuffleTeams() {
+		return "", errShuffleInProgress
+	}
+	if err := g.shuffleTeams(players); err != nil {
+		return "", err
+	}
+	return src.Name + " shuffled the teams", nil
+}
@@ -10,6 +10,10 @@ type gameState struct {
 
 	roles map[uuid.UUID]role
 
+	// departed holds the roles of players who left in the middle of the current game, so
+	// they get them back if they return before it is over.
+	departed map[uuid.UUID]role
+
 	// currentTurn marks which kind of players are currently active (rolePurpleSeeker, etc.).
 	// The roleSpectator (0) value indicates that no game/match/round is in progress, i.e.,
 	// the players must set up a game.
@@ -26,6 +30,13 @@ type gameState struct {
 	winner team
 
 	gameLog []gameEventInfo
+
+	// history holds a checkpoint from after each move in the current game, for undoing
+	// them (see undo.go)
+	history games.Checkpoints[checkpoint]
+
+	room   games.Room
+	router games.Router
 }
 
 func (g *gameState) newGame() {
@@ -35,45 +46,103 @@ func (g *gameState) newGame() {
 	g.gameEnded = false
 	g.winner = teamNone
 	g.gameLog = make([]gameEventInfo, 0, 10)
+	g.departed = nil
 }
 
 func (g *gameState) broadcastRolesState(players []*games.Client) {
-	msg := g.encodeRolesState()
-
-	for _, p := range players {
-		p.Send(msg)
-	}
+	games.BroadcastSnapshot(players, g.encodeRolesState())
 }
 
 func (g *gameState) broadcastBoardState(players []*games.Client) {
-	boardStateKnower := g.encodeBoardState(true)
-	boardStateSeeker := g.encodeBoardState(false)
+	knowers := make([]*games.Client, 0, 2)
+	others := make([]*games.Client, 0, len(players))
 
 	for _, p := range players {
-		var boardState []byte
-
 		if g.roles[p.ID].IsKnower() {
-			boardState = boardStateKnower
+			knowers = append(knowers, p)
 		} else {
-			boardState = boardStateSeeker
+			others = append(others, p)
 		}
+	}
 
-		p.Send(boardState)
+	if len(knowers) > 0 {
+		games.BroadcastSnapshot(knowers, g.encodeBoardState(true))
+	}
+	if len(others) > 0 {
+		games.BroadcastSnapshot(others, g.encodeBoardState(false))
 	}
 }
 
-func (g *gameState) Init(players []*games.Client) {
+func (g *gameState) Init(room games.Room, players []*games.Client) {
+	g.room = room
 	// Don't need to broadcast roles because they all start out as
 	// spectators, and spectator is the default role
 	g.broadcastBoardState(players)
 }
 
 func (g *gameState) HandleNewPlayer(c *games.Client) {
-	c.Send(g.encodeBoardState(g.roles[c.ID].IsKnower()))
-	c.Send(g.encodeRolesState())
+	c.SendSnapshot(g.encodeBoardState(g.roles[c.ID].IsKnower()))
+	c.SendSnapshot(g.encodeRolesState())
+}
+
+func (g *gameState) HandlePlayerLeft(players []*games.Client, c *games.Client) {
+	r, ok := g.roles[c.ID]
+	if !ok {
+		return
+	}
+
+	delete(g.roles, c.ID)
+	if !g.gameEnded {
+		if g.departed == nil {
+			g.departed = make(map[uuid.UUID]role)
+		}
+		g.departed[c.ID] = r
+	}
+
+	g.broadcastRolesState(players)
+	games.RefreshChatChannels(players)
+
+	// Nothing happens until somebody else takes over the role
+	if !g.gameEnded && r == g.currentTurn && !g.roleTaken(r) {
+		kind := "seekers"
+		if r.IsKnower() {
+			kind = "knower"
+		}
+		games.Narrate(players, r.Team().String()+" has no "+kind+" left, waiting for someone to take over")
+	}
+}
+
+func (g *gameState) HandlePlayerRejoined(players []*games.Client, c *games.Client) {
+	r, ok := g.departed[c.ID]
+	if !ok {
+		return
+	}
+
+	delete(g.departed, c.ID)
+	g.roles[c.ID] = r
+
+	g.broadcastRolesState(players)
+	games.RefreshChatChannels(players)
+
+	// HandleNewPlayer sent them the board as a spectator
+	if r.IsKnower() {
+		c.SendSnapshot(g.encodeBoardState(true))
+	}
+}
+
+// roleTaken returns true if any player has the given role.
+func (g *gameState) roleTaken(r role) bool {
+	for _, pr := range g.roles {
+		if pr == r {
+			return true
+		}
+	}
+	return false
 }
 
 func (g *gameState) Deinit() {
 	g.roles = nil
+	g.departed = nil
+	g.history = games.Checkpoints[checkpoint]{}
 	g.gameLog = nil
 }
@@ -0,0 +1,69 @@
+package bravewength
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// This file implements (github.com/samclaus/games).JSONGame so that clients using the
+// JSON encoding get Bravewength state embedded as JSON instead of base64. State messages
+// are converted using the protocol description, so their JSON form has the same keys as
+// the objects decoded by the generated TypeScript.
+
+var requestTypes = map[string]byte{
+	"set_role":        reqSetRole,
+	"randomize_teams": reqRandomizeTeams,
+	"new_game":        reqNewGame,
+	"end_game":        reqEndGame,
+	"give_clue":       reqGiveClue,
+	"reveal_card":     reqRevealCard,
+	"end_turn":        reqEndTurn,
+}
+
+// jsonRequest has a field for every argument of every request type; only the ones
+// relevant to the given type are used.
+type jsonRequest struct {
+	Type  string `json:"type"`
+	Role  role   `json:"role"`
+	Clue  string `json:"clue"`
+	Index uint8  `json:"index"`
+}
+
+// StateJSON turns a state message into {"type": <name>, <field>: <value>...}.
+func (g game) StateJSON(body []byte) []byte {
+	obj, err := schema.DecodeState(body)
+	if err != nil {
+		return nil
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (g game) RequestFromJSON(data []byte) ([]byte, error) {
+	var req jsonRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+
+	reqType, ok := requestTypes[req.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown request type %q", req.Type)
+	}
+
+	body := []byte{reqType}
+
+	switch reqType {
+	case reqSetRole:
+		body = append(body, byte(req.Role))
+	case reqGiveClue:
+		body = append(body, req.Clue...)
+	case reqRevealCard:
+		body = append(body, req.Index)
+	}
+
+	return body, nil
+}
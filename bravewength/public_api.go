@@ -1,8 +1,11 @@
 package bravewength
 
 import (
+	_ "embed"
+
 	"github.com/google/uuid"
 	"github.com/samclaus/games"
+	"github.com/samclaus/games/protocol"
 )
 
 type game struct {
@@ -14,7 +17,7 @@ func (g game) ID() string {
 }
 
 func (g game) Version() int {
-	return 0
+	return 1
 }
 
 func (g game) NewInstance() games.GameState {
@@ -25,6 +28,8 @@ func (g game) NewInstance() games.GameState {
 		roles: make(map[uuid.UUID]role),
 	}
 	instance.newGame()
+	instance.history.Reset(instance.checkpoint())
+	instance.registerRequests()
 
 	return instance
 }
@@ -50,3 +55,17 @@ func Game(deck []string) games.Game {
 
 	return game{deck}
 }
+
+var _ games.JSONGame = game{}
+
+//go:embed protocol.json
+var protocolJSON []byte
+
+var schema = protocol.MustParseSchema(protocolJSON)
+
+// Protocol satisfies (github.com/samclaus/games).DescribedGame.
+func (g game) Protocol() protocol.Schema {
+	return schema
+}
+
+var _ games.DescribedGame = game{}
@@ -1,10 +1,14 @@
 package bravewength
 
 // This file contains types and deserialization code for every type of request a player can
-// make to the server.
+// make to the server. Any change to the requests must also be made to protocol.json.
 
 import (
+	"errors"
+	"math/rand"
+
 	"github.com/samclaus/games"
+	"github.com/samclaus/games/wire"
 )
 
 const (
@@ -38,185 +42,266 @@ const (
 	reqEndTurn
 )
 
+var (
+	errRoleUnchanged = errors.New("role cannot be changed")
+	errEmptyClue     = errors.New("clue is empty")
+	errCardRevealed  = errors.New("card is already revealed")
+	errInvalidRole   = errors.New("invalid role")
+	errInvalidCard   = errors.New("invalid card index")
+	errTooFewPlayers = errors.New("need at least two players on teams")
+)
+
+func decodeRole(r *wire.Reader) role {
+	newRole := role(r.U8())
+	if newRole > roleTealKnower {
+		r.Fail(errInvalidRole)
+	}
+	return newRole
+}
+
+func decodeCardIndex(r *wire.Reader) uint8 {
+	cardIndex := r.U8()
+	if cardIndex >= boardSize {
+		r.Fail(errInvalidCard)
+	}
+	return cardIndex
+}
+
+func decodeClue(r *wire.Reader) string {
+	return string(r.Tail())
+}
+
+// registerRequests registers a handler for every type of request with the game's router.
+func (g *gameState) registerRequests() {
+	rt := &g.router
+
+	inProgress := games.Require("no game in progress", func(games.Request) bool {
+		return !g.gameEnded
+	})
+	canShuffle := games.Require("game under way", func(games.Request) bool {
+		return g.canShuffleTeams()
+	})
+	myTurn := games.TurnOf(&g.currentTurn, func(src *games.Client) role {
+		return g.roles[src.ID]
+	})
+	knower := games.Require("requester is not a knower", func(req games.Request) bool {
+		return g.roles[req.Src.ID].IsKnower()
+	})
+	seeker := games.Require("requester is not a seeker", func(req games.Request) bool {
+		return g.roles[req.Src.ID].IsSeeker()
+	})
+
+	rt.OnAccept = g.saveCheckpoint
+
+	games.Handle(rt, reqSetRole, "set_role", decodeRole, g.setRole)
+	games.Handle(rt, reqRandomizeTeams, "randomize_teams", games.NoArgs, g.randomizeTeams, canShuffle)
+	games.Handle(rt, reqNewGame, "new_game", games.NoArgs, g.startNewGame)
+	games.Handle(rt, reqEndGame, "end_game", games.NoArgs, g.endGame, inProgress)
+	games.Handle(rt, reqGiveClue, "give_clue", decodeClue, g.giveClue, inProgress, myTurn, knower)
+	games.Handle(rt, reqRevealCard, "reveal_card", decodeCardIndex, g.revealCard, inProgress, myTurn, seeker)
+	games.Handle(rt, reqEndTurn, "end_turn", games.NoArgs, g.endTurn, inProgress, myTurn, seeker)
+}
+
 // HandleRequest is required to satisfy the (github.com/samclaus/games).Game interface and
 // implements all turn-based game logic for Bravewength.
 //
 // TODO: tell room to disconnect client for sending invalid request structure?
 func (g *gameState) HandleRequest(players []*games.Client, src *games.Client, payload []byte) {
-	if len(payload) == 0 {
-		return
-	}
+	g.router.Dispatch(players, src, payload)
+}
 
-	body := payload[1:]
-	turn := g.currentTurn
-	srcID := src.ID
+func (g *gameState) setRole(req games.Request, newRole role) error {
+	srcID := req.Src.ID
 	srcRole := g.roles[srcID]
+	isKnower := srcRole.IsKnower()
+	willBeKnower := newRole.IsKnower()
+
+	// If a game is in-progress, knowers may change teams but may not change to
+	// seekers or spectators because they have seen the card layout; we also do not
+	// want to issue state changes if nothing got changed
+	if newRole == srcRole || (!g.gameEnded && isKnower && !willBeKnower) {
+		return errRoleUnchanged
+	}
 
-	switch payload[0] {
-	case reqSetRole:
-		if len(body) != 1 || body[0] > 4 {
-			return
-		}
+	// Spectator is the default role
+	if newRole == roleSpectator {
+		delete(g.roles, srcID)
+	} else {
+		g.roles[srcID] = newRole
+	}
 
-		newRole := role(body[0])
-		isKnower := srcRole.IsKnower()
-		willBeKnower := newRole.IsKnower()
+	g.broadcastRolesState(req.Players)
+	games.RefreshChatChannels(req.Players)
 
-		// If a game is in-progress, knowers may change teams but may not change to
-		// seekers or spectators because they have seen the card layout; we also do not
-		// want to issue state changes if nothing got changed
-		if newRole == srcRole || (!g.gameEnded && isKnower && !willBeKnower) {
-			return
-		}
-
-		// Spectator is the default role
-		if newRole == roleSpectator {
-			delete(g.roles, srcID)
-		} else {
-			// TODO: prevent map from growing too large if people keep connecting,
-			// setting role, and disconnecting
-			g.roles[srcID] = newRole
-		}
+	// If card visibility changed, we must send them freshly tailored game state
+	if isKnower != willBeKnower {
+		req.Src.SendSnapshot(g.encodeBoardState(willBeKnower))
+	}
+	return nil
+}
 
-		g.broadcastRolesState(players)
+func (g *gameState) randomizeTeams(req games.Request, _ struct{}) error {
+	return g.shuffleTeams(req.Players)
+}
 
-		// If card visibility changed, we must send them freshly tailored game state
-		if isKnower != willBeKnower {
-			src.Send(g.encodeBoardState(willBeKnower))
+// shuffleTeams puts every player who has a role on a random team. Knowers stay knowers
+// and seekers stay seekers, but each kind is split as evenly as possible between the
+// teams.
+// canShuffleTeams returns true if the teams can be shuffled, which is only until the
+// first clue of a game is given (e.g., in the lobby right after the game was booted),
+// or after the game is over.
+func (g *gameState) canShuffleTeams() bool {
+	if g.gameEnded {
+		return true
+	}
+	for _, e := range g.gameLog {
+		if e.Kind == gameEventTypeClueGiven {
+			return false
 		}
+	}
+	return true
+}
 
-	case reqNewGame:
-		g.newGame()
-		g.gameLog = append(g.gameLog, gameEventInfo{
-			Src:  srcID.String(),
-			Role: srcRole,
-			Kind: gameEventTypeGameStarted,
-		})
-		g.broadcastBoardState(players)
-
-	case reqEndGame:
-		// Cannot end game if no game is in-progress
-		if !g.gameEnded {
-			g.gameEnded = true
-			g.winner = teamNone
-			g.gameLog = append(g.gameLog, gameEventInfo{
-				Src:  srcID.String(),
-				Role: srcRole,
-				Kind: gameEventTypeGameEnded,
-			})
-			g.broadcastBoardState(players)
+func (g *gameState) shuffleTeams(players []*games.Client) error {
+	var knowers, seekers []*games.Client
+	for _, p := range players {
+		if r := g.roles[p.ID]; r.IsKnower() {
+			knowers = append(knowers, p)
+		} else if r.IsSeeker() {
+			seekers = append(seekers, p)
 		}
+	}
+	if len(knowers)+len(seekers) < 2 {
+		return errTooFewPlayers
+	}
 
-	case reqRandomizeTeams:
-		// TODO
-	case reqGiveClue:
-		if len(body) == 0 {
-			return
+	assign := func(group []*games.Client, teal, purple role) {
+		rand.Shuffle(len(group), func(i, j int) {
+			group[i], group[j] = group[j], group[i]
+		})
+		first := rand.Intn(2)
+		for i, p := range group {
+			if (i+first)%2 == 0 {
+				g.roles[p.ID] = teal
+			} else {
+				g.roles[p.ID] = purple
+			}
 		}
+	}
+	assign(knowers, roleTealKnower, rolePurpleKnower)
+	assign(seekers, roleTealSeeker, rolePurpleSeeker)
 
-		// Cannot give a clue if:
-		// - The game is over
-		// - It is not the requester's turn
-		// - The requester is not a knower
-		if g.gameEnded || srcRole != turn || !srcRole.IsKnower() {
-			return
-		}
+	g.broadcastRolesState(players)
+	games.RefreshChatChannels(players)
+	return nil
+}
 
-		clue := string(body)
+func (g *gameState) startNewGame(req games.Request, _ struct{}) error {
+	g.newGame()
+	g.logEvent(req, gameEventTypeGameStarted)
+	g.broadcastBoardState(req.Players)
+	games.RefreshChatChannels(req.Players)
+	return nil
+}
 
-		g.currentTurn = turn.NextTurn()
-		g.currentClue = clue
-		g.gameLog = append(g.gameLog, gameEventInfo{
-			Src:  srcID.String(),
-			Role: srcRole,
-			Kind: gameEventTypeClueGiven,
-			Clue: clue,
-		})
-		g.broadcastBoardState(players)
+func (g *gameState) endGame(req games.Request, _ struct{}) error {
+	g.gameEnded = true
+	g.winner = teamNone
+	g.logEvent(req, gameEventTypeGameEnded)
+	g.broadcastBoardState(req.Players)
+	games.RefreshChatChannels(req.Players)
+	return nil
+}
 
-	case reqRevealCard:
-		if len(body) != 1 || body[0] >= boardSize {
-			return
-		}
-		cardIndex := body[0]
-
-		// Cannot reveal a card if:
-		// - The game is over
-		// - It is not the requester's turn
-		// - The requester is not a seeker
-		// - The card has already been revealed
-		if g.gameEnded ||
-			srcRole != turn ||
-			!srcRole.IsSeeker() ||
-			g.Board.DiscTypes[cardIndex] != cardTypeHidden {
-			return
-		}
+func (g *gameState) giveClue(req games.Request, clue string) error {
+	if clue == "" {
+		return errEmptyClue
+	}
 
-		revealedType := g.Board.FullTypes[cardIndex]
-		g.Board.DiscTypes[cardIndex] = revealedType
+	g.currentTurn = g.currentTurn.NextTurn()
+	g.currentClue = clue
+	g.gameLog = append(g.gameLog, gameEventInfo{
+		Src:  req.Src.ID,
+		Role: g.roles[req.Src.ID],
+		Kind: gameEventTypeClueGiven,
+		Clue: clue,
+	})
+	g.broadcastBoardState(req.Players)
+	return nil
+}
 
-		g.gameLog = append(g.gameLog, gameEventInfo{
-			Src:      srcID.String(),
-			Role:     srcRole,
-			Kind:     gameEventTypeCardRevealed,
-			Word:     g.Board.Words[cardIndex],
-			CardType: revealedType,
-		})
+func (g *gameState) revealCard(req games.Request, cardIndex uint8) error {
+	if g.Board.DiscTypes[cardIndex] != cardTypeHidden {
+		return errCardRevealed
+	}
 
-		tealPlayer := srcRole == roleTealKnower || srcRole == roleTealSeeker
+	srcRole := g.roles[req.Src.ID]
+	revealedType := g.Board.FullTypes[cardIndex]
+	word := g.Board.Words[cardIndex]
+	g.Board.DiscTypes[cardIndex] = revealedType
+
+	g.gameLog = append(g.gameLog, gameEventInfo{
+		Src:      req.Src.ID,
+		Role:     srcRole,
+		Kind:     gameEventTypeCardRevealed,
+		Word:     word,
+		CardType: revealedType,
+	})
+
+	if revealedType == cardTypeBlack {
+		games.Narrate(req.Players, srcRole.Team().String()+" picked the assassin, "+word)
+	} else {
+		games.Narrate(req.Players, srcRole.Team().String()+" picked "+word)
+	}
 
-		if revealedType == cardTypeBlack {
-			g.gameEnded = true
+	tealPlayer := srcRole == roleTealKnower || srcRole == roleTealSeeker
 
-			if tealPlayer {
-				g.winner = teamPurple
-			} else {
-				g.winner = teamTeal
-			}
+	if revealedType == cardTypeBlack {
+		g.gameEnded = true
 
-			g.gameLog = append(g.gameLog, gameEventInfo{
-				Src:  srcID.String(),
-				Role: srcRole,
-				Kind: gameEventTypeGameEnded,
-			})
-		} else if revealedType == cardTypeNeutral {
-			g.currentTurn = turn.NextTurn()
-		} else if winner := g.Board.winner(); winner != teamNone {
-			g.gameEnded = true
-			g.winner = winner
-			g.gameLog = append(g.gameLog, gameEventInfo{
-				Src:  srcID.String(),
-				Role: srcRole,
-				Kind: gameEventTypeGameEnded,
-			})
+		if tealPlayer {
+			g.winner = teamPurple
 		} else {
-			tealCard := revealedType == cardTypeTeal
-
-			if tealPlayer != tealCard {
-				g.currentTurn = turn.NextTurn()
-			}
+			g.winner = teamTeal
 		}
 
-		g.broadcastBoardState(players)
-
-	case reqEndTurn:
-		// Cannot end turn if:
-		// - The game is over
-		// - It is not the requester's turn
-		// - The requester is not a seeker
-		if g.gameEnded ||
-			srcRole != turn ||
-			!srcRole.IsSeeker() {
-			return
+		g.logEvent(req, gameEventTypeGameEnded)
+	} else if revealedType == cardTypeNeutral {
+		g.currentTurn = g.currentTurn.NextTurn()
+	} else if winner := g.Board.winner(); winner != teamNone {
+		g.gameEnded = true
+		g.winner = winner
+		g.logEvent(req, gameEventTypeGameEnded)
+	} else {
+		tealCard := revealedType == cardTypeTeal
+
+		if tealPlayer != tealCard {
+			g.currentTurn = g.currentTurn.NextTurn()
 		}
+	}
 
-		g.currentTurn = turn.NextTurn()
-		g.gameLog = append(g.gameLog, gameEventInfo{
-			Src:  srcID.String(),
-			Role: srcRole,
-			Kind: gameEventTypeTurnEnded,
-		})
-		g.broadcastBoardState(players)
+	g.broadcastBoardState(req.Players)
 
+	if g.gameEnded {
+		games.Narrate(req.Players, g.winner.String()+" wins!")
+		games.RefreshChatChannels(req.Players)
+		g.room.Emit("won", map[string]string{"team": g.winner.String()})
 	}
+	return nil
+}
+
+func (g *gameState) endTurn(req games.Request, _ struct{}) error {
+	g.currentTurn = g.currentTurn.NextTurn()
+	g.logEvent(req, gameEventTypeTurnEnded)
+	g.broadcastBoardState(req.Players)
+	return nil
+}
+
+// logEvent appends an event without a clue or card to the game log.
+func (g *gameState) logEvent(req games.Request, kind gameEventType) {
+	g.gameLog = append(g.gameLog, gameEventInfo{
+		Src:  req.Src.ID,
+		Role: g.roles[req.Src.ID],
+		Kind: kind,
+	})
 }
@@ -1,18 +1,44 @@
 package bravewength
 
 import (
+	"github.com/google/uuid"
 	"github.com/samclaus/games"
+	"github.com/samclaus/games/wire"
 )
 
 // This file contains constants and serialization code for every kind of
-// message a room will send to clients to update their state.
+// message a room will send to clients to update their state. Any change to
+// the messages must also be made to protocol.json, which is checked by
+// running `go run ./cmd/protogen -check`.
 
-// TODO: optimized binary format and we definitely don't need to send the full
-// state (especially the potentially big player UUID->role mapping) every time
-// something happens
+// TODO: we definitely don't need to send the full state (especially the
+// potentially big player UUID->role mapping) every time something happens
 
 const (
+	// The full board and game log. Only knowers (and everyone, once the game
+	// ends) get to see the full layout.
+	//
+	// 1. 25 strings, the words on the board
+	// 2. 25 uint8 card types of discovered cards (cardTypeHidden if undiscovered)
+	// 3. 25 uint8 card types of the full layout (all cardTypeHidden unless the
+	//    client may see it)
+	// 4. uint8 role whose turn it is
+	// 5. string current clue
+	// 6. bool whether the game has ended
+	// 7. uint8 winning team
+	// 8. 0 or more game log entries of:
+	//		1. UUID client ID of the player who caused the event
+	//		2. uint8 role of that player
+	//		3. uint8 event kind
+	//		4. string clue (for gameEventTypeClueGiven)
+	//		5. string word (for gameEventTypeCardRevealed)
+	//		6. uint8 card type (for gameEventTypeCardRevealed)
 	stateBoard byte = iota
+	// Role of every player who is not a spectator.
+	//
+	// 0 or more of:
+	//		1. UUID client ID
+	//		2. uint8 role
 	stateRoles
 )
 
@@ -32,68 +58,58 @@ const (
 // simpler on the server, but clients can easily make use of, say,
 // TypeScript discriminated unions to make the events easier to work with.
 type gameEventInfo struct {
-	Src      string        `json:"src"`
-	Role     role          `json:"role"`
-	Kind     gameEventType `json:"kind"`
-	Clue     string        `json:"clue"`
-	Word     string        `json:"word"`
-	CardType cardType      `json:"card_type"`
-}
-
-type boardStateBody struct {
-	Words       []string        `json:"words"`
-	DiscTypes   string          `json:"disc_types"`
-	FullTypes   string          `json:"full_types"`
-	CurrentTurn role            `json:"current_turn"`
-	CurrentClue string          `json:"current_clue"`
-	GameEnded   bool            `json:"game_ended"`
-	Winner      team            `json:"winner"`
-	Log         []gameEventInfo `json:"log"`
+	Src      uuid.UUID
+	Role     role
+	Kind     gameEventType
+	Clue     string
+	Word     string
+	CardType cardType
 }
 
 func (g *gameState) encodeBoardState(showFullLayout bool) []byte {
-	var discTypesASCII [boardSize]byte
+	w := wire.NewVarintWriter(games.AllocGameMessage(512 + len(g.gameLog)*32))
+	w.U8(stateBoard)
 
-	for i, ct := range g.Board.DiscTypes {
-		discTypesASCII[i] = ct.ascii()
+	for _, word := range g.Board.Words {
+		w.Str(word)
+	}
+	for _, ct := range g.Board.DiscTypes {
+		w.U8(uint8(ct))
 	}
 
-	var fullTypesASCII string
-
+	fullTypes := &allCardsHidden
 	if showFullLayout || g.gameEnded {
-		var ascii [boardSize]byte
-
-		for i, ct := range g.Board.FullTypes {
-			ascii[i] = ct.ascii()
-		}
+		fullTypes = &g.Board.FullTypes
+	}
+	for _, ct := range fullTypes {
+		w.U8(uint8(ct))
+	}
 
-		fullTypesASCII = string(ascii[:])
-	} else {
-		// All hidden
-		fullTypesASCII = "4444444444444444444444444"
+	w.U8(uint8(g.currentTurn))
+	w.Str(g.currentClue)
+	w.Bool(g.gameEnded)
+	w.U8(uint8(g.winner))
+
+	for _, ev := range g.gameLog {
+		w.UUID(ev.Src)
+		w.U8(uint8(ev.Role))
+		w.U8(uint8(ev.Kind))
+		w.Str(ev.Clue)
+		w.Str(ev.Word)
+		w.U8(uint8(ev.CardType))
 	}
 
-	body := mustEncodeJSON(
-		boardStateBody{
-			Words:       g.Board.Words[:],
-			DiscTypes:   string(discTypesASCII[:]),
-			FullTypes:   fullTypesASCII,
-			CurrentTurn: g.currentTurn,
-			CurrentClue: g.currentClue,
-			GameEnded:   g.gameEnded,
-			Winner:      g.winner,
-			Log:         g.gameLog,
-		},
-	)
-
-	return append(
-		append(games.AllocGameMessage(1+len(body)), stateBoard),
-		body...,
-	)
+	return w.Bytes()
 }
 
 func (g *gameState) encodeRolesState() []byte {
-	body := mustEncodeJSON(g.roles)
-	msg := append(games.AllocGameMessage(1+len(body)), stateRoles)
-	return append(msg, body...)
+	w := wire.NewVarintWriter(games.AllocGameMessage(1 + len(g.roles)*17))
+	w.U8(stateRoles)
+
+	for id, r := range g.roles {
+		w.UUID(id)
+		w.U8(uint8(r))
+	}
+
+	return w.Bytes()
 }
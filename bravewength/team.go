@@ -8,6 +8,20 @@ const (
 	teamPurple
 )
 
+var teamNames = [...]string{
+	teamNone:   "Nobody",
+	teamTeal:   "Teal",
+	teamPurple: "Purple",
+}
+
+// String returns the name of the team, as shown in chat narration.
+func (t team) String() string {
+	if int(t) < len(teamNames) {
+		return teamNames[t]
+	}
+	return "Unknown team"
+}
+
 func (r role) Team() team {
 	// TODO: optimize the enums so we can just use simple math or a table
 	switch r {
@@ -0,0 +1,61 @@
+package bravewength
+
+import "github.com/samclaus/games"
+
+// checkpoint is everything a move can change, for undoing moves. The words and card
+// types stay the same for the whole game, and the game log only grows, so it is enough
+// to remember how long the log was.
+type checkpoint struct {
+	discTypes   [boardSize]cardType
+	currentTurn role
+	currentClue string
+	gameEnded   bool
+	winner      team
+	logLen      int
+}
+
+func (g *gameState) checkpoint() checkpoint {
+	return checkpoint{
+		discTypes:   g.Board.DiscTypes,
+		currentTurn: g.currentTurn,
+		currentClue: g.currentClue,
+		gameEnded:   g.gameEnded,
+		winner:      g.winner,
+		logLen:      len(g.gameLog),
+	}
+}
+
+// saveCheckpoint is called by the router after every accepted request. Changing roles
+// isn't a move, so it can't be undone, and neither can starting a new game. Nor can
+// the move that ended a game: the win was already announced, and departed players'
+// roles may already be gone.
+func (g *gameState) saveCheckpoint(req games.Request) {
+	switch {
+	case g.gameEnded || req.Op == reqNewGame:
+		g.history.Reset(g.checkpoint())
+	case req.Op == reqSetRole || req.Op == reqRandomizeTeams:
+	default:
+		g.history.Save(g.checkpoint())
+	}
+}
+
+func (g *gameState) CanUndo() bool {
+	return g.history.CanUndo()
+}
+
+func (g *gameState) Undo(players []*games.Client) {
+	cp, ok := g.history.Undo()
+	if !ok {
+		return
+	}
+
+	g.Board.DiscTypes = cp.discTypes
+	g.currentTurn = cp.currentTurn
+	g.currentClue = cp.currentClue
+	g.gameEnded = cp.gameEnded
+	g.winner = cp.winner
+	g.gameLog = g.gameLog[:cp.logLen]
+
+	g.broadcastBoardState(players)
+	games.RefreshChatChannels(players)
+}
@@ -0,0 +1,135 @@
+package games
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/samclaus/games/protocol"
+)
+
+// Buffers bigger than this are not returned to the pool so that one huge message
+// doesn't pin a huge buffer in memory forever
+const maxPooledBufferSize = 16 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 512)
+		return &buf
+	},
+}
+
+// Broadcast sends the same message to every given client, with the same semantics as
+// calling Send() for each of them, but much cheaper for large rooms because the
+// WebSocket frame is only built once and shared between the clients. THIS IS ONLY
+// SAFE TO CALL FROM THE ROOM'S PROCESSING GOROUTINE!
+func Broadcast(players []*Client, msg []byte) {
+	broadcastGameMessage(players, msg, false)
+}
+
+// BroadcastSnapshot is like Broadcast, but has the semantics of calling SendSnapshot()
+// for each client. THIS IS ONLY SAFE TO CALL FROM THE ROOM'S PROCESSING GOROUTINE!
+func BroadcastSnapshot(players []*Client, msg []byte) {
+	broadcastGameMessage(players, msg, true)
+}
+
+// Narrate appends a line of narration from the game to the room's chat, like "Teal
+// revealed the assassin", and sends it to every member. Lines longer than 100 bytes are
+// cut short. THIS IS ONLY SAFE TO CALL FROM THE ROOM'S PROCESSING GOROUTINE!
+func Narrate(players []*Client, text string) {
+	if len(players) == 0 || text == "" {
+		return
+	}
+	players[0].room.postNote(protocol.ChatGame, uuid.Nil, text)
+}
+
+func broadcastGameMessage(players []*Client, msg []byte, snapshot bool) {
+	if len(players) == 0 {
+		return
+	}
+
+	r := players[0].room
+
+	broadcastEncoded(players, kindOf(msg), snapshot, func(dst []byte, e encoding) []byte {
+		return r.appendGameMessage(dst, e, msg)
+	})
+}
+
+// broadcastState sends a room-scope state message to every member, encoded however
+// each member asked for.
+//
+// Sending can cause members to be evicted, but evictions are deferred until the current
+// event is done, so it is safe to loop over the members slice (whether here or in game
+// code).
+func (r *room) broadcastState(m protocol.Message, snapshot bool) {
+	r.broadcastStateTo(r.members, m, snapshot)
+}
+
+// broadcastStateTo is like broadcastState, but only sends the message to some members.
+func (r *room) broadcastStateTo(members []*Client, m protocol.Message, snapshot bool) {
+	broadcastEncoded(members, uint16(scopeRoom)<<8|uint16(m.Type()), snapshot, func(dst []byte, e encoding) []byte {
+		return e.appendState(dst, m)
+	})
+}
+
+// sendState sends a room-scope state message to a single client.
+func (r *room) sendState(c *Client, m protocol.Message, snapshot bool) {
+	msg := c.enc.appendState(nil, m)
+	c.enqueue(newOutgoing(msg, uint16(scopeRoom)<<8|uint16(m.Type()), snapshot))
+}
+
+// broadcastEncoded encodes a message once for each encoding used by the given clients
+// and sends it to all of them. Each message is encoded into a pooled buffer, which can
+// go back to the pool right away because preparing the message makes a copy of it; a
+// separate exact-size copy is only made if some client needs the raw message because
+// they are sequenced (or they are the only client using that encoding).
+func broadcastEncoded(players []*Client, kind uint16, snapshot bool, encode func(dst []byte, e encoding) []byte) {
+	var counts [numEncodings]int
+	var needRaw [numEncodings]bool
+
+	for _, c := range players {
+		counts[c.enc]++
+		needRaw[c.enc] = needRaw[c.enc] || c.sequenced
+	}
+
+	for e := encoding(0); e < numEncodings; e++ {
+		if counts[e] == 0 {
+			continue
+		}
+
+		bufp := bufferPool.Get().(*[]byte)
+		msg := encode((*bufp)[:0], e)
+		out := newOutgoing(msg, kind, snapshot)
+
+		if counts[e] > 1 {
+			out.prepared = prepare(msg, e)
+		}
+		if out.prepared == nil || needRaw[e] {
+			out.msg = append(make([]byte, 0, len(msg)), msg...)
+		} else {
+			out.msg = nil
+		}
+
+		for _, c := range players {
+			if c.enc == e {
+				c.enqueue(out)
+			}
+		}
+
+		if cap(msg) <= maxPooledBufferSize {
+			*bufp = msg[:0]
+			bufferPool.Put(bufp)
+		}
+	}
+}
+
+// prepare builds a shared WebSocket frame for the message, returning nil if that
+// fails (in which case clients just get the raw message).
+func prepare(msg []byte, e encoding) *websocket.PreparedMessage {
+	pm, err := websocket.NewPreparedMessage(e.frameType(), msg)
+	if err != nil {
+		debug("Failed to prepare %d byte message: %v", len(msg), err)
+		return nil
+	}
+	return pm
+}
@@ -0,0 +1,139 @@
+package games
+
+import (
+	"compress/flate"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// benchMembers makes a full room's worth of members, for realistic message sizes.
+func benchMembers() []*Client {
+	members := make([]*Client, maxRoomMembers)
+	for i := range members {
+		members[i] = &Client{ID: uuid.New(), Name: fmt.Sprintf("Player %d", i+1)}
+	}
+	return members
+}
+
+// benchConns connects a full room's worth of WebSockets to a test server, returning
+// the server's end of each one. The client ends throw away everything without even
+// decoding it, so that only the server's side of the work gets measured.
+func benchConns(b *testing.B, compress bool) []*websocket.Conn {
+	b.Helper()
+
+	upgrader := websocket.Upgrader{EnableCompression: compress}
+	accepted := make(chan *websocket.Conn)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			b.Errorf("upgrade: %v", err)
+			return
+		}
+		accepted <- conn
+	}))
+	b.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{EnableCompression: compress}
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	conns := make([]*websocket.Conn, maxRoomMembers)
+
+	for i := range conns {
+		remote, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			b.Fatalf("dial: %v", err)
+		}
+
+		go io.Copy(io.Discard, remote.UnderlyingConn())
+
+		conn := <-accepted
+		b.Cleanup(func() {
+			conn.Close()
+			remote.Close()
+		})
+		if compress {
+			conn.SetCompressionLevel(flate.BestSpeed)
+			conn.EnableWriteCompression(true)
+		}
+		conns[i] = conn
+	}
+
+	return conns
+}
+
+// BenchmarkBroadcast compares building a frame for each member with preparing one
+// frame and sharing it (see broadcastEncoded), with and without compression.
+func BenchmarkBroadcast(b *testing.B) {
+	msg := encodingBinaryV2.appendState(nil, setMembersState(benchMembers()))
+
+	for _, compress := range []bool{false, true} {
+		name := "raw"
+		if compress {
+			name = "compressed"
+		}
+
+		b.Run(name+"/per-client", func(b *testing.B) {
+			conns := benchConns(b, compress)
+			b.SetBytes(int64(len(msg) * len(conns)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				for _, conn := range conns {
+					if err := conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+
+		b.Run(name+"/prepared", func(b *testing.B) {
+			conns := benchConns(b, compress)
+			b.SetBytes(int64(len(msg) * len(conns)))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				pm := prepare(msg, encodingBinaryV2)
+				for _, conn := range conns {
+					if err := conn.WritePreparedMessage(pm); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEncodeMembersState compares encoding the member list into a pooled buffer,
+// like broadcastEncoded does, with encoding it into a new buffer every time.
+func BenchmarkEncodeMembersState(b *testing.B) {
+	members := benchMembers()
+
+	names := [numEncodings]string{"binary", "binary-v2", "json"}
+
+	for e := encoding(0); e < numEncodings; e++ {
+		e := e
+
+		b.Run(names[e]+"/fresh", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				e.appendState(nil, setMembersState(members))
+			}
+		})
+
+		b.Run(names[e]+"/pooled", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bufp := bufferPool.Get().(*[]byte)
+				msg := e.appendState((*bufp)[:0], setMembersState(members))
+				*bufp = msg[:0]
+				bufferPool.Put(bufp)
+			}
+		})
+	}
+}
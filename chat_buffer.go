@@ -2,85 +2,193 @@ package games
 
 import (
 	"encoding/binary"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/samclaus/games/protocol"
 )
 
 const (
-	maxScrollback = 50                     // must be 255 or less because we only use 1 byte for message count
-	maxMessageLen = 100                    // must be 255 or less because we only use 1 byte for message length
-	lineLen       = 16 + 1 + maxMessageLen // 16-byte client UUID, message length, message capacity
+	// defaultChatHistory is how many messages each chat channel remembers unless
+	// ServerConfig.ChatHistory says otherwise
+	defaultChatHistory = 1000
+
+	// historyBurst is how many of a channel's newest messages clients get when they
+	// join (or first see the channel); they can ask for older ones a page at a time
+	historyBurst = 50
+	historyPage  = 50
+
+	maxMessageLen = 100 // must be 255 or less because we only use 1 byte for message length
+
+	// 8-byte timestamp, message kind, 16-byte client UUID, message length, message capacity
+	lineLen = 8 + 1 + 16 + 1 + maxMessageLen
 )
 
+// chatBuffer is the scrollback of a single chat channel: a ring buffer of fixed-size
+// lines, which only grows as messages are added, up to the channel's limit.
 type chatBuffer struct {
-	buff [maxScrollback * lineLen]byte
-	hist uint16
+	buff  []byte
+	limit int // most messages to remember
+
+	// count is how many messages have been added over the life of the room, which is
+	// also the ID of the next message
+	count uint64
+
+	// reactions holds the reactions to each message still in the buffer which has any
+	// (see chat_reactions.go), keyed by message ID
+	reactions map[uint64][]reactionGroup
+}
+
+func newChatBuffer(limit int) *chatBuffer {
+	if limit <= 0 {
+		limit = defaultChatHistory
+	}
+	return &chatBuffer{limit: limit}
 }
 
 func (cb *chatBuffer) numMessages() int {
-	if cb.hist > maxScrollback {
-		return maxScrollback
+	if cb.count > uint64(cb.limit) {
+		return cb.limit
 	}
-	return int(cb.hist)
+	return int(cb.count)
 }
 
-func (cb *chatBuffer) addMessage(clientID uuid.UUID, msg []byte) bool {
+// oldestID is the ID of the oldest message still in the buffer.
+func (cb *chatBuffer) oldestID() uint64 {
+	return cb.count - uint64(cb.numMessages())
+}
+
+// linePos returns where the line for a message is in the buffer. Until the buffer is
+// full, messages are stored in ID order from the start, so this only wraps around
+// once it is.
+func (cb *chatBuffer) linePos(id uint64) int {
+	return int(id%uint64(cb.limit)) * lineLen
+}
+
+// addMessage appends a message typed by a member, returning false (and leaving the
+// buffer alone) if it is empty or too long.
+func (cb *chatBuffer) addMessage(clientID uuid.UUID, msg []byte) (protocol.ChatMessage, bool) {
 	if len(msg) < 1 || len(msg) > maxMessageLen {
+		return protocol.ChatMessage{}, false
+	}
+	return cb.add(protocol.ChatPlayer, clientID, msg), true
+}
+
+// addNote appends a system message or game narration. Unlike messages from members,
+// notes which are too long get cut short (at a UTF-8 character boundary) rather than
+// rejected, because they often contain member names.
+func (cb *chatBuffer) addNote(kind byte, clientID uuid.UUID, text string) protocol.ChatMessage {
+	if len(text) > maxMessageLen {
+		n := maxMessageLen
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		text = text[:n]
+	}
+	return cb.add(kind, clientID, []byte(text))
+}
+
+func (cb *chatBuffer) add(kind byte, clientID uuid.UUID, msg []byte) protocol.ChatMessage {
+	line := protocol.ChatMessage{
+		ID:      cb.count,
+		Time:    uint64(time.Now().UnixMilli()),
+		Kind:    kind,
+		Src:     clientID,
+		Content: string(msg),
+	}
+
+	pos := cb.linePos(cb.count)
+	if pos == len(cb.buff) {
+		cb.buff = append(cb.buff, make([]byte, lineLen)...)
+	} else {
+		// Overwriting the oldest message, so its reactions go too
+		delete(cb.reactions, cb.count-uint64(cb.limit))
+	}
+
+	binary.BigEndian.PutUint64(cb.buff[pos:], line.Time)
+	cb.buff[pos+8] = kind
+	copy(cb.buff[pos+9:pos+25], clientID[:])
+	cb.buff[pos+25] = byte(len(msg))
+	copy(cb.buff[pos+26:pos+26+len(msg)], msg)
+	cb.count++
+
+	return line
+}
+
+// deleteMessage wipes out the contents of a message, leaving it in the history as a
+// message of kind ChatDeleted. Returns false if the message is too old to still be in
+// the buffer (or does not exist yet), or was already deleted.
+func (cb *chatBuffer) deleteMessage(id uint64) bool {
+	if id >= cb.count || id < cb.oldestID() {
 		return false
 	}
 
-	pos := (cb.hist % maxScrollback) * lineLen
-	copy(cb.buff[pos:pos+16], clientID[:])
-	cb.buff[pos+16] = byte(len(msg))
-	copy(cb.buff[pos+17:pos+17+uint16(len(msg))], msg)
-	cb.hist++
+	pos := cb.linePos(id)
+	if cb.buff[pos+8] == protocol.ChatDeleted {
+		return false
+	}
 
+	cb.buff[pos+8] = protocol.ChatDeleted
+	cb.buff[pos+25] = 0
+	delete(cb.reactions, id)
 	return true
 }
 
-// Calculate size of encoded history (number of bytes required) up-front to
-// avoid wasteful memory allocations due to automatic slice growth
-func (cb *chatBuffer) encodedHistoryLen() int {
-	numMessages := cb.numMessages()
+// messages returns the messages with IDs from start up to (not including) end, which
+// must still be in the buffer, oldest first.
+func (cb *chatBuffer) messages(start, end uint64) []protocol.ChatMessage {
+	lines := make([]protocol.ChatMessage, 0, end-start)
+
+	for id := start; id < end; id++ {
+		pos := cb.linePos(id)
+		msgLen := int(cb.buff[pos+25])
 
-	// 2 bytes for uint16 length of message HISTORY (not scrollback) +
-	// <number of retained messages> * (16 bytes for client UUID + 1 byte for message length)
-	encLen := 2 + numMessages*(16+1)
+		line := protocol.ChatMessage{
+			ID:   id,
+			Time: binary.BigEndian.Uint64(cb.buff[pos:]),
+			Kind: cb.buff[pos+8],
+		}
+		copy(line.Src[:], cb.buff[pos+9:pos+25])
+		line.Content = string(cb.buff[pos+26 : pos+26+msgLen])
 
-	for i := 0; i < numMessages; i++ {
-		encLen += int(cb.buff[i*lineLen+16])
+		lines = append(lines, line)
 	}
 
-	return encLen
+	return lines
 }
 
-func (cb *chatBuffer) appendHistory(dst []byte) []byte {
-	dst = binary.BigEndian.AppendUint16(dst, cb.hist)
-
-	currentLine := int(cb.hist % maxScrollback)
-	numMessages := cb.numMessages()
-
-	// Start from the current offset
-	for i := currentLine; i < numMessages; i++ {
-		pos := i * lineLen
-		msgLen := cb.buff[pos+16]
+// historyState builds the state message telling a client about the newest few
+// messages, oldest first.
+func (cb *chatBuffer) historyState() *protocol.AllChatMessagesState {
+	start := cb.oldestID()
+	if cb.count-start > historyBurst {
+		start = cb.count - historyBurst
+	}
 
-		dst = append(dst, cb.buff[pos:pos+16]...)                // client UUID
-		dst = append(dst, msgLen)                                // message length
-		dst = append(dst, cb.buff[pos+17:pos+17+int(msgLen)]...) // message contents
+	return &protocol.AllChatMessagesState{
+		History:  cb.count,
+		Messages: cb.messages(start, cb.count),
 	}
+}
 
-	// In case we have more than <maxScrollback> messages, we need to start
-	// from beginning of buffer and work our way to the current line to get
-	// the newest messages
-	for i := 0; i < currentLine; i++ {
-		pos := i * lineLen
-		msgLen := cb.buff[pos+16]
+// olderState builds the state message answering a request for the page of messages
+// before the given ID, which may be empty if there are no older messages left.
+func (cb *chatBuffer) olderState(before uint64) *protocol.OlderChatMessagesState {
+	end := before
+	if end > cb.count {
+		end = cb.count
+	}
 
-		dst = append(dst, cb.buff[pos:pos+16]...)                // client UUID
-		dst = append(dst, msgLen)                                // message length
-		dst = append(dst, cb.buff[pos+17:pos+17+int(msgLen)]...) // message contents
+	start := cb.oldestID()
+	if end < start {
+		end = start
+	} else if end-start > historyPage {
+		start = end - historyPage
 	}
 
-	return dst
+	return &protocol.OlderChatMessagesState{
+		Before:   before,
+		Messages: cb.messages(start, end),
+	}
 }
@@ -0,0 +1,170 @@
+package games
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/protocol"
+)
+
+// fillChat makes a chat buffer remembering limit messages and adds n messages to it,
+// whose contents are their IDs.
+func fillChat(t *testing.T, limit, n int) *chatBuffer {
+	t.Helper()
+
+	cb := newChatBuffer(limit)
+	for i := 0; i < n; i++ {
+		if _, ok := cb.addMessage(uuid.Nil, []byte(strconv.Itoa(i))); !ok {
+			t.Fatalf("message %d rejected", i)
+		}
+	}
+	return cb
+}
+
+// checkMessages checks that msgs are the messages with IDs from start up to (not
+// including) end, as added by fillChat.
+func checkMessages(t *testing.T, msgs []protocol.ChatMessage, start, end uint64) {
+	t.Helper()
+
+	if len(msgs) != int(end-start) {
+		t.Fatalf("got %d messages, want IDs %d to %d", len(msgs), start, end)
+	}
+	for i, m := range msgs {
+		id := start + uint64(i)
+		if m.ID != id || m.Content != strconv.FormatUint(id, 10) {
+			t.Errorf("message %d is ID %d with content %q, want %d", i, m.ID, m.Content, id)
+		}
+	}
+}
+
+func TestChatBufferHistory(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      int
+		added      int
+		wantOldest uint64
+		wantStart  uint64 // first ID sent to clients when they join
+	}{
+		{name: "empty", limit: 10, added: 0, wantOldest: 0, wantStart: 0},
+		{name: "not full", limit: 10, added: 4, wantOldest: 0, wantStart: 0},
+		{name: "exactly full", limit: 10, added: 10, wantOldest: 0, wantStart: 0},
+		{name: "wrapped around", limit: 10, added: 25, wantOldest: 15, wantStart: 15},
+		{name: "more than a burst", limit: 200, added: 120, wantOldest: 0, wantStart: 120 - historyBurst},
+		{name: "wrapped, more than a burst", limit: 120, added: 500, wantOldest: 380, wantStart: 500 - historyBurst},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := fillChat(t, tt.limit, tt.added)
+
+			if got := cb.oldestID(); got != tt.wantOldest {
+				t.Errorf("oldest ID = %d, want %d", got, tt.wantOldest)
+			}
+
+			h := cb.historyState()
+			if h.History != uint64(tt.added) {
+				t.Errorf("history = %d, want %d", h.History, tt.added)
+			}
+			checkMessages(t, h.Messages, tt.wantStart, uint64(tt.added))
+		})
+	}
+}
+
+func TestChatBufferOlder(t *testing.T) {
+	// Remembers IDs 80 to 199
+	cb := fillChat(t, 120, 200)
+
+	tests := []struct {
+		before     uint64
+		start, end uint64
+	}{
+		{before: 150, start: 100, end: 150},
+		{before: 100, start: 80, end: 100},
+		{before: 90, start: 80, end: 90},
+		{before: 80, start: 80, end: 80},
+		{before: 10, start: 80, end: 80},
+		{before: 500, start: 150, end: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run("before "+strconv.FormatUint(tt.before, 10), func(t *testing.T) {
+			older := cb.olderState(tt.before)
+			if older.Before != tt.before {
+				t.Errorf("before = %d, want %d", older.Before, tt.before)
+			}
+			checkMessages(t, older.Messages, tt.start, tt.end)
+		})
+	}
+}
+
+func TestChatBufferAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		ok   bool
+	}{
+		{name: "empty", msg: "", ok: false},
+		{name: "longest", msg: strings.Repeat("a", maxMessageLen), ok: true},
+		{name: "too long", msg: strings.Repeat("a", maxMessageLen+1), ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := newChatBuffer(10)
+			line, ok := cb.addMessage(uuid.Nil, []byte(tt.msg))
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && line.Content != tt.msg {
+				t.Errorf("content = %q, want %q", line.Content, tt.msg)
+			}
+			want := 0
+			if ok {
+				want = 1
+			}
+			if cb.numMessages() != want {
+				t.Errorf("buffer has %d messages, want %d", cb.numMessages(), want)
+			}
+		})
+	}
+
+	t.Run("long note", func(t *testing.T) {
+		// "é" is 2 bytes, so cutting the note at maxMessageLen would split one
+		note := "x" + strings.Repeat("é", maxMessageLen)
+		line := newChatBuffer(10).addNote(protocol.ChatSystem, uuid.Nil, note)
+		if want := note[:maxMessageLen-1]; line.Content != want {
+			t.Errorf("note cut to %d bytes, want %d", len(line.Content), len(want))
+		}
+	})
+}
+
+func TestChatBufferDelete(t *testing.T) {
+	// Remembers IDs 5 to 9
+	cb := fillChat(t, 5, 10)
+
+	tests := []struct {
+		id uint64
+		ok bool
+	}{
+		{id: 7, ok: true},
+		{id: 7, ok: false}, // already deleted
+		{id: 5, ok: true},
+		{id: 4, ok: false}, // too old
+		{id: 10, ok: false},
+	}
+
+	for _, tt := range tests {
+		if ok := cb.deleteMessage(tt.id); ok != tt.ok {
+			t.Errorf("deleting %d: ok = %v, want %v", tt.id, ok, tt.ok)
+		}
+	}
+
+	for _, m := range cb.messages(5, 10) {
+		deleted := m.ID == 5 || m.ID == 7
+		if got := m.Kind == protocol.ChatDeleted; got != deleted || (deleted && m.Content != "") {
+			t.Errorf("message %d has kind %d and content %q after deleting", m.ID, m.Kind, m.Content)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package games
+
+import (
+	"github.com/google/uuid"
+	"github.com/samclaus/games/protocol"
+)
+
+// This file contains the room's handling of chat channels other than the global one:
+// channels defined by the current game (see ChatChannels), and channels for direct
+// messages between two members. Each channel has its own chatBuffer, so its own
+// scrollback and message IDs.
+
+// RefreshChatChannels tells every member which of the current game's chat channels they
+// can see, if that changed, along with the history of any channel they could not see
+// before. Games implementing ChatChannels must call it whenever the answers might have
+// changed, e.g., because a player switched teams. THIS IS ONLY SAFE TO CALL FROM THE
+// ROOM'S PROCESSING GOROUTINE!
+func RefreshChatChannels(players []*Client) {
+	if len(players) == 0 {
+		return
+	}
+	players[0].room.refreshChannels()
+}
+
+func (r *room) refreshChannels() {
+	for _, c := range r.members {
+		r.syncChannels(c, false)
+	}
+}
+
+// gameChannels returns the channels defined by the current game which the client can
+// see, or nil if the game does not define any (or there is no game).
+func (r *room) gameChannels(c *Client) []protocol.Channel {
+	var channels []protocol.Channel
+	if cc, ok := r.currentGame.(ChatChannels); ok {
+		r.callGame("ChatChannels", c, nil, func() { channels = cc.ChatChannels(c) })
+	}
+	return channels
+}
+
+// canMessageDirectly returns true unless the current game forbids one member from
+// sending a direct message to another.
+func (r *room) canMessageDirectly(from, to *Client) bool {
+	allowed := true
+	if cc, ok := r.currentGame.(ChatChannels); ok {
+		r.callGame("CanMessageDirectly", from, nil, func() { allowed = cc.CanMessageDirectly(from, to) })
+	}
+	return allowed
+}
+
+// syncChannels tells the client which channels defined by the current game it can see,
+// plus the history of each channel it could not see before, unless nothing changed.
+// With full set, the client is assumed to know nothing, e.g., because it just joined.
+func (r *room) syncChannels(c *Client, full bool) {
+	channels := r.gameChannels(c)
+
+	if full {
+		c.channels = nil
+		if len(channels) == 0 {
+			return
+		}
+	} else if channelsEqual(channels, c.channels) {
+		return
+	}
+
+	r.sendState(c, &protocol.SetChannelsState{Channels: channels}, false)
+	for _, ch := range channels {
+		if findChannel(c.channels, ch.ID) < 0 {
+			r.sendHistory(c, ch.ID, r.channels[ch.ID])
+		}
+	}
+	c.channels = channels
+}
+
+// sendDirectHistory sends the history of every direct message channel the client is
+// part of, for a client building its view of the room from scratch.
+func (r *room) sendDirectHistory(c *Client) {
+	for id, cb := range r.channels {
+		if a, b, ok := protocol.ParseDirectChannel(id); ok && (a == c.ID || b == c.ID) {
+			r.sendHistory(c, id, cb)
+		}
+	}
+}
+
+// sendHistory sends a client the history of a channel, which may not have any
+// messages yet (cb may be nil), followed by the reactions to those messages.
+func (r *room) sendHistory(c *Client, id string, cb *chatBuffer) {
+	if cb == nil {
+		r.sendState(c, &protocol.AllChatMessagesState{Channel: id}, false)
+		return
+	}
+
+	m := cb.historyState()
+	m.Channel = id
+	r.sendState(c, m, false)
+	r.sendReactions(c, id, cb, m.Messages)
+}
+
+// sendReactions sends a client the reactions to some messages from a channel, if
+// there are any.
+func (r *room) sendReactions(c *Client, id string, cb *chatBuffer, messages []protocol.ChatMessage) {
+	if m := cb.reactionsState(messages); m != nil {
+		m.Channel = id
+		r.sendState(c, m, false)
+	}
+}
+
+// visibleChannel returns the buffer for a channel and true if the client can see the
+// channel, which may not have a buffer (i.e., any messages) yet.
+func (r *room) visibleChannel(c *Client, id string) (*chatBuffer, bool) {
+	if id == protocol.GlobalChannel {
+		return r.chat, true
+	}
+	if a, b, ok := protocol.ParseDirectChannel(id); ok {
+		return r.channels[id], a == c.ID || b == c.ID
+	}
+	return r.channels[id], findChannel(c.channels, id) >= 0
+}
+
+// sendOlderMessages sends a client the page of messages before the given ID from a
+// channel, if they can see it.
+func (r *room) sendOlderMessages(c *Client, m *protocol.OlderChatMessagesRequest) {
+	cb, ok := r.visibleChannel(c, m.Channel)
+	if !ok {
+		return
+	}
+
+	if cb == nil {
+		r.sendState(c, &protocol.OlderChatMessagesState{Channel: m.Channel, Before: m.Before}, false)
+		return
+	}
+
+	page := cb.olderState(m.Before)
+	page.Channel = m.Channel
+	r.sendState(c, page, false)
+	r.sendReactions(c, m.Channel, cb, page.Messages)
+}
+
+// channelBuffer returns the buffer for a channel, creating it if need be.
+func (r *room) channelBuffer(id string) *chatBuffer {
+	cb := r.channels[id]
+	if cb == nil {
+		if r.channels == nil {
+			r.channels = make(map[string]*chatBuffer)
+		}
+		cb = newChatBuffer(r.chatHistory)
+		r.channels[id] = cb
+	}
+	return cb
+}
+
+// postToChannel appends a member's message to a channel defined by the current game
+// and sends it to every member who can see the channel, if the member may post there,
+// or runs it if it is a slash command.
+func (r *room) postToChannel(src *Client, id string, content string) {
+	if id == protocol.GlobalChannel {
+		r.postToGlobal(src, content)
+		return
+	}
+
+	channels := r.gameChannels(src)
+	if pos := findChannel(channels, id); pos < 0 || !channels[pos].CanPost {
+		r.debug("Client %q may not post to channel %q", src.Name, id)
+		return
+	}
+	if isChatCommand(content) {
+		r.runChatCommand(src, id, content)
+		return
+	}
+
+	content, ok := r.screenChat(src, id, content)
+	if !ok {
+		return
+	}
+
+	if line, ok := r.channelBuffer(id).addMessage(src.ID, []byte(content)); ok {
+		r.broadcastStateTo(r.channelAudience(id), &protocol.NewChatMessageState{Channel: id, ChatMessage: line}, false)
+	}
+}
+
+// channelAudience returns the members who can see a channel.
+func (r *room) channelAudience(id string) []*Client {
+	if id == protocol.GlobalChannel {
+		return r.members
+	}
+	if a, b, ok := protocol.ParseDirectChannel(id); ok {
+		var audience []*Client
+		for _, c := range r.members {
+			if c.ID == a || c.ID == b {
+				audience = append(audience, c)
+			}
+		}
+		return audience
+	}
+
+	var audience []*Client
+	for _, c := range r.members {
+		if findChannel(c.channels, id) >= 0 {
+			audience = append(audience, c)
+		}
+	}
+	return audience
+}
+
+// screenChat checks whether a member may post a message to a channel right now, and
+// runs it through the server's chat filter, returning the message to post.
+func (r *room) screenChat(src *Client, channel, content string) (string, bool) {
+	if r.muted(src) {
+		r.debug("Client %q is muted", src.Name)
+		return "", false
+	}
+	if r.chatFilter != nil {
+		filtered, ok := r.chatFilter.FilterChat(channel, content)
+		if !ok {
+			r.debug("Chat filter rejected a message from %q", src.Name)
+		}
+		return filtered, ok
+	}
+	return content, true
+}
+
+// postDirect sends a direct message from one member to another, unless the current
+// game forbids it.
+func (r *room) postDirect(src *Client, toID uuid.UUID, content string) {
+	to := r.member(toID)
+	if to == nil || to.ID == src.ID {
+		return
+	}
+
+	if !r.canMessageDirectly(src, to) {
+		r.debug("Client %q may not message %q directly", src.Name, to.Name)
+		return
+	}
+
+	id := protocol.DirectChannel(src.ID, to.ID)
+	content, ok := r.screenChat(src, id, content)
+	if !ok {
+		return
+	}
+
+	if line, ok := r.channelBuffer(id).addMessage(src.ID, []byte(content)); ok {
+		// Both of them might be connected more than once (e.g., in two browser tabs)
+		r.broadcastStateTo(r.channelAudience(id), &protocol.NewChatMessageState{Channel: id, ChatMessage: line}, false)
+	}
+}
+
+// postToGlobal appends a member's message to the global channel and sends it to
+// everyone, or runs it if it is a slash command.
+func (r *room) postToGlobal(src *Client, content string) {
+	if isChatCommand(content) {
+		r.runChatCommand(src, protocol.GlobalChannel, content)
+		return
+	}
+
+	content, ok := r.screenChat(src, protocol.GlobalChannel, content)
+	if !ok {
+		return
+	}
+
+	if line, ok := r.chat.addMessage(src.ID, []byte(content)); ok {
+		r.broadcastState(&protocol.NewChatMessageState{ChatMessage: line}, false)
+	}
+}
+
+// dropGameChannels forgets the history of every channel defined by the game, which is
+// called when the game is killed.
+func (r *room) dropGameChannels() {
+	for id := range r.channels {
+		if _, _, ok := protocol.ParseDirectChannel(id); !ok {
+			delete(r.channels, id)
+		}
+	}
+}
+
+// dropDirectChannels forgets the history of every direct message channel a member
+// was part of, which is called once they leave the room for good.
+func (r *room) dropDirectChannels(c *Client) {
+	for id := range r.channels {
+		if a, b, ok := protocol.ParseDirectChannel(id); ok && (a == c.ID || b == c.ID) {
+			delete(r.channels, id)
+		}
+	}
+}
+
+func findChannel(channels []protocol.Channel, id string) int {
+	for i, ch := range channels {
+		if ch.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func channelsEqual(a, b []protocol.Channel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package games
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samclaus/games/protocol"
+)
+
+// This file contains slash commands: chat messages starting with a slash, which the
+// room runs instead of posting. Commands are either built into the room or added by the
+// current game (see ChatCommands), and their results are posted as system messages.
+
+const (
+	maxDice  = 20
+	maxSides = 1000
+)
+
+var (
+	errNoName        = errors.New("usage: /name <new name>")
+	errLongName      = errors.New("names must be at most " + strconv.Itoa(maxNameLen) + " bytes")
+	errBadDice       = errors.New("usage: /roll [dice], e.g., /roll 2d6")
+	errNoKickTarget  = errors.New("usage: /kick <name>")
+	errNotModerator  = errors.New("only moderators can kick members")
+	errKickModerator = errors.New("only the host can kick moderators")
+	errGamePaused    = errors.New("the game is paused")
+)
+
+// isChatCommand returns true if a chat message should be run as a slash command.
+func isChatCommand(content string) bool {
+	return len(content) > 1 && content[0] == '/'
+}
+
+// chatCommands returns the room's built-in commands, followed by the current game's.
+func (r *room) chatCommands() []ChatCommand {
+	commands := []ChatCommand{
+		{"roll", "[dice]", "roll dice, e.g., /roll 2d6", r.rollCommand},
+		{"flip", "", "flip a coin", r.flipCommand},
+		{"name", "<new name>", "change your name", r.nameCommand},
+		{"kick", "<name>", "kick a member from the room, as a moderator", r.kickCommand},
+		{"help", "[command]", "list the commands, or explain one", r.helpCommand},
+	}
+	if cc, ok := r.currentGame.(ChatCommands); ok {
+		var gameCommands []ChatCommand
+		r.callGame("ChatCommands", nil, nil, func() { gameCommands = cc.ChatCommands() })
+		for _, cmd := range gameCommands {
+			commands = append(commands, r.guardChatCommand(cmd))
+		}
+	}
+	return commands
+}
+
+// guardChatCommand wraps a command added by the current game so that the room recovers
+// if it panics, like any other call into the game, and so that it can't be run while
+// the game is paused.
+func (r *room) guardChatCommand(cmd ChatCommand) ChatCommand {
+	run := cmd.Run
+	cmd.Run = func(players []*Client, src *Client, args []string) (result string, err error) {
+		if r.paused {
+			return "", errGamePaused
+		}
+		r.callGame("chat command /"+cmd.Name, src, nil, func() {
+			result, err = run(players, src, args)
+		})
+		return result, err
+	}
+	return cmd
+}
+
+// findChatCommand returns the command with the given name, or nil if there is none.
+func (r *room) findChatCommand(name string) *ChatCommand {
+	commands := r.chatCommands()
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// runChatCommand runs a slash command a member sent to a channel, posting the result
+// to the same channel. The member must be allowed to post to the channel.
+func (r *room) runChatCommand(src *Client, channel, content string) {
+	if r.muted(src) {
+		r.debug("Client %q is muted", src.Name)
+		return
+	}
+
+	fields := strings.Fields(content[1:])
+	if len(fields) == 0 {
+		return
+	}
+
+	name := strings.ToLower(fields[0])
+	cmd := r.findChatCommand(name)
+	if cmd == nil {
+		r.postNoteIn(channel, protocol.ChatSystem, src.ID, src.Name+": unknown command /"+name+", try /help")
+		return
+	}
+
+	result, err := cmd.Run(r.members, src, fields[1:])
+	if err != nil {
+		r.postNoteIn(channel, protocol.ChatSystem, src.ID, src.Name+": "+err.Error())
+		return
+	}
+
+	for _, line := range strings.Split(result, "\n") {
+		if line != "" {
+			r.postNoteIn(channel, protocol.ChatSystem, src.ID, line)
+		}
+	}
+}
+
+func (r *room) rollCommand(_ []*Client, src *Client, args []string) (string, error) {
+	dice, sides := 1, 6
+	if len(args) > 1 {
+		return "", errBadDice
+	}
+	if len(args) == 1 {
+		var ok bool
+		if dice, sides, ok = parseDice(args[0]); !ok {
+			return "", errBadDice
+		}
+	}
+
+	rolls := make([]string, dice)
+	total := 0
+	for i := range rolls {
+		n := 1 + rand.Intn(sides)
+		rolls[i] = strconv.Itoa(n)
+		total += n
+	}
+
+	text := src.Name + " rolled " + strconv.Itoa(dice) + "d" + strconv.Itoa(sides) + ": "
+	if dice == 1 {
+		return text + rolls[0], nil
+	}
+	return text + strings.Join(rolls, " + ") + " = " + strconv.Itoa(total), nil
+}
+
+// parseDice parses dice notation like "2d6" or "d20" (one die).
+func parseDice(s string) (dice, sides int, ok bool) {
+	before, after, found := strings.Cut(strings.ToLower(s), "d")
+	if !found {
+		return 0, 0, false
+	}
+
+	dice = 1
+	if before != "" {
+		n, err := strconv.Atoi(before)
+		if err != nil || n < 1 || n > maxDice {
+			return 0, 0, false
+		}
+		dice = n
+	}
+
+	sides, err := strconv.Atoi(after)
+	if err != nil || sides < 2 || sides > maxSides {
+		return 0, 0, false
+	}
+	return dice, sides, true
+}
+
+func (r *room) flipCommand(_ []*Client, src *Client, _ []string) (string, error) {
+	side := "heads"
+	if rand.Intn(2) == 1 {
+		side = "tails"
+	}
+	return src.Name + " flipped a coin: " + side, nil
+}
+
+func (r *room) nameCommand(_ []*Client, src *Client, args []string) (string, error) {
+	name := strings.Join(args, " ")
+	if name == "" {
+		return "", errNoName
+	}
+	if !validName(name) {
+		return "", errLongName
+	}
+	if name == src.Name {
+		return "", nil
+	}
+
+	// Every connection of the member (e.g., other browser tabs) goes by the new name
+	old := src.Name
+	for _, m := range r.members {
+		if m.ID == src.ID {
+			m.Name = name
+		}
+	}
+	r.broadcastAllMembersState()
+	return old + " is now " + name, nil
+}
+
+func (r *room) kickCommand(_ []*Client, src *Client, args []string) (string, error) {
+	if !r.isModerator(src) {
+		return "", errNotModerator
+	}
+
+	name := strings.Join(args, " ")
+	if name == "" {
+		return "", errNoKickTarget
+	}
+
+	var target *Client
+	for _, c := range r.members {
+		if c.Name == name && c != src {
+			if target != nil {
+				return "", errors.New("more than one member is named " + name)
+			}
+			target = c
+		}
+	}
+	if target == nil {
+		return "", errors.New("nobody else is named " + name)
+	}
+	// Moderators can only kick regular members; the host can kick anybody
+	if src.ID != r.host && r.isModerator(target) {
+		return "", errKickModerator
+	}
+
+	r.evict(target, closeKicked)
+	return src.Name + " kicked " + target.Name, nil
+}
+
+func (r *room) helpCommand(_ []*Client, _ *Client, args []string) (string, error) {
+	if len(args) > 0 {
+		name := strings.ToLower(strings.TrimPrefix(args[0], "/"))
+		cmd := r.findChatCommand(name)
+		if cmd == nil {
+			return "", errors.New("no command /" + name)
+		}
+		usage := "/" + cmd.Name
+		if cmd.Args != "" {
+			usage += " " + cmd.Args
+		}
+		return usage + ": " + cmd.Help, nil
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, cmd := range r.chatCommands() {
+		if !seen[cmd.Name] {
+			seen[cmd.Name] = true
+			names = append(names, "/"+cmd.Name)
+		}
+	}
+	sort.Strings(names)
+	return "Commands: " + strings.Join(names, " "), nil
+}
@@ -0,0 +1,85 @@
+package games
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultWords are the words masked by the filter servers use unless they are given
+// another one (see ServerConfig.ChatFilter).
+var defaultWords = []string{
+	"asshole", "bastard", "bitch", "bollocks", "bullshit", "cock", "cunt", "dick",
+	"dickhead", "fag", "faggot", "fuck", "fucked", "fucker", "fucking", "motherfucker",
+	"nigga", "nigger", "prick", "pussy", "retard", "shit", "slut", "twat", "wanker",
+	"whore",
+}
+
+// NoChatFilter is a ChatFilter which lets every message through unchanged, for turning
+// off the default filter (see ServerConfig.ChatFilter).
+var NoChatFilter ChatFilter = noChatFilter{}
+
+type noChatFilter struct{}
+
+func (noChatFilter) FilterChat(_, content string) (string, bool) {
+	return content, true
+}
+
+// WordListFilter is the stock ChatFilter. It looks for words from a list, ignoring
+// case, and either rejects messages containing them or masks the words with asterisks.
+// A word is any run of letters and digits, so listed words are not found inside longer
+// words ("ass" does not match "class").
+type WordListFilter struct {
+	words  map[string]bool
+	reject bool
+}
+
+// NewWordListFilter creates a filter for the given words, which rejects messages
+// containing them if reject is true, and otherwise masks them.
+func NewWordListFilter(words []string, reject bool) *WordListFilter {
+	f := &WordListFilter{
+		words:  make(map[string]bool, len(words)),
+		reject: reject,
+	}
+	for _, w := range words {
+		f.words[strings.ToLower(w)] = true
+	}
+	return f
+}
+
+func (f *WordListFilter) FilterChat(channel, content string) (string, bool) {
+	var out []byte // only allocated once a word needs masking
+	copied := 0    // how much of the content has been copied to out
+
+	for start := 0; start < len(content); {
+		end := start
+		for end < len(content) {
+			c, size := utf8.DecodeRuneInString(content[end:])
+			if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				break
+			}
+			end += size
+		}
+
+		if end == start {
+			_, size := utf8.DecodeRuneInString(content[start:])
+			start += size
+			continue
+		}
+
+		if word := content[start:end]; f.words[strings.ToLower(word)] {
+			if f.reject {
+				return "", false
+			}
+			out = append(out, content[copied:start]...)
+			out = append(out, strings.Repeat("*", utf8.RuneCountInString(word))...)
+			copied = end
+		}
+		start = end
+	}
+
+	if out == nil {
+		return content, true
+	}
+	return string(append(out, content[copied:]...)), true
+}
@@ -0,0 +1,144 @@
+package games
+
+import (
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/protocol"
+)
+
+// This file contains emoji reactions to chat messages. Each chatBuffer keeps the
+// reactions to its messages, grouped by emoji, until the messages fall out of the buffer
+// or get deleted.
+
+const (
+	maxEmojiLen = 32 // in bytes; emoji made of several code points can be pretty long
+
+	// maxReactionGroups is how many different emoji a single message can be reacted
+	// with, to keep a few members from using up a bunch of memory
+	maxReactionGroups = 20
+)
+
+// reactionGroup is every member who reacted to a message with the same emoji, in the
+// order they reacted.
+type reactionGroup struct {
+	emoji   string
+	members []uuid.UUID
+}
+
+// validEmoji returns true if s looks enough like an emoji to react with. Checking for
+// actual emoji would mean keeping a table of them up to date, so this just makes sure
+// it is short and is not plain text, allowing digits, '#' and '*' for keycap emoji.
+func validEmoji(s string) bool {
+	if s == "" || len(s) > maxEmojiLen || !utf8.ValidString(s) {
+		return false
+	}
+
+	fancy := false
+	for _, r := range s {
+		switch {
+		case r >= utf8.RuneSelf:
+			fancy = true
+		case (r < '0' || r > '9') && r != '#' && r != '*':
+			return false
+		}
+	}
+	return fancy
+}
+
+// toggleReaction adds a member's reaction to a message, or takes it back if they
+// already reacted with the same emoji, returning every member who has reacted to the
+// message with that emoji afterwards. Returns false (and leaves the reactions alone) if
+// the message is no longer in the buffer, was deleted, or has too many reactions.
+func (cb *chatBuffer) toggleReaction(id uint64, emoji string, member uuid.UUID) ([]uuid.UUID, bool) {
+	if id >= cb.count || id < cb.oldestID() || cb.buff[cb.linePos(id)+8] == protocol.ChatDeleted {
+		return nil, false
+	}
+
+	groups := cb.reactions[id]
+	pos := -1
+	for i := range groups {
+		if groups[i].emoji == emoji {
+			pos = i
+			break
+		}
+	}
+
+	if pos < 0 {
+		if len(groups) >= maxReactionGroups {
+			return nil, false
+		}
+		if cb.reactions == nil {
+			cb.reactions = make(map[uint64][]reactionGroup)
+		}
+		cb.reactions[id] = append(groups, reactionGroup{emoji, []uuid.UUID{member}})
+		return []uuid.UUID{member}, true
+	}
+
+	g := &groups[pos]
+	for i, m := range g.members {
+		if m == member {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			members := g.members
+
+			if len(members) == 0 {
+				groups = append(groups[:pos], groups[pos+1:]...)
+				if len(groups) == 0 {
+					delete(cb.reactions, id)
+				} else {
+					cb.reactions[id] = groups
+				}
+			}
+			return members, true
+		}
+	}
+
+	g.members = append(g.members, member)
+	return g.members, true
+}
+
+// reactionsState builds the state message telling a client about every reaction to
+// the given messages, or returns nil if none of them have any.
+func (cb *chatBuffer) reactionsState(messages []protocol.ChatMessage) *protocol.ChatReactionsState {
+	var reactions []protocol.Reaction
+
+	for _, msg := range messages {
+		for _, g := range cb.reactions[msg.ID] {
+			for _, member := range g.members {
+				reactions = append(reactions, protocol.Reaction{
+					ID:     msg.ID,
+					Emoji:  g.emoji,
+					Member: member,
+				})
+			}
+		}
+	}
+
+	if len(reactions) == 0 {
+		return nil
+	}
+	return &protocol.ChatReactionsState{Reactions: reactions}
+}
+
+func (r *room) toggleReaction(src *Client, m *protocol.ToggleReactionRequest) {
+	if !validEmoji(m.Emoji) || r.muted(src) {
+		return
+	}
+
+	cb, ok := r.visibleChannel(src, m.Channel)
+	if !ok || cb == nil {
+		return
+	}
+
+	members, ok := cb.toggleReaction(m.ID, m.Emoji, src.ID)
+	if !ok {
+		return
+	}
+
+	r.broadcastStateTo(r.channelAudience(m.Channel), &protocol.SetReactionState{
+		Channel: m.Channel,
+		ID:      m.ID,
+		Emoji:   m.Emoji,
+		Members: members,
+	}, false)
+}
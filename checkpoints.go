@@ -0,0 +1,57 @@
+package games
+
+// defaultCheckpoints is how many checkpoints a Checkpoints keeps if its Limit is zero.
+const defaultCheckpoints = 50
+
+// Checkpoints is a history of copies of a game's state, for implementing Undoable. The
+// game resets it whenever a new game (or round) starts, so that there is a checkpoint
+// to go back to, and saves a new checkpoint after each request it accepts. T should be
+// a value type, or at least something that isn't changed after it is saved. The zero
+// value is ready to use.
+type Checkpoints[T any] struct {
+	// Limit is how many checkpoints are kept, dropping the oldest ones; 50 if zero.
+	Limit int
+
+	saved []T
+}
+
+// Reset forgets every checkpoint, starting over with the given state.
+func (c *Checkpoints[T]) Reset(state T) {
+	c.saved = append(c.saved[:0], state)
+}
+
+// Save adds a checkpoint, unless there is nothing to go back to from it (i.e., Reset has
+// not been called).
+func (c *Checkpoints[T]) Save(state T) {
+	if len(c.saved) == 0 {
+		return
+	}
+
+	limit := c.Limit
+	if limit <= 0 {
+		limit = defaultCheckpoints
+	}
+	if len(c.saved) >= limit {
+		n := copy(c.saved, c.saved[len(c.saved)-limit+1:])
+		c.saved = c.saved[:n]
+	}
+
+	c.saved = append(c.saved, state)
+}
+
+// CanUndo returns true if there is a checkpoint before the latest one.
+func (c *Checkpoints[T]) CanUndo() bool {
+	return len(c.saved) > 1
+}
+
+// Undo drops the latest checkpoint and returns the one before it, which becomes the
+// latest, or returns false if there is none.
+func (c *Checkpoints[T]) Undo() (T, bool) {
+	if !c.CanUndo() {
+		var zero T
+		return zero, false
+	}
+
+	c.saved = c.saved[:len(c.saved)-1]
+	return c.saved[len(c.saved)-1], true
+}
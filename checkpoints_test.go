@@ -0,0 +1,52 @@
+package games
+
+import (
+	"testing"
+)
+
+func TestCheckpoints(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		reset bool // whether Reset(0) is called first
+		saves int  // Save(1), Save(2), ...
+		undos int  // how many times Undo works, going back to saves-1, saves-2, ...
+	}{
+		{name: "never reset", saves: 3, undos: 0},
+		{name: "just reset", reset: true, undos: 0},
+		{name: "undo everything", reset: true, saves: 3, undos: 3},
+		{name: "limited", limit: 3, reset: true, saves: 5, undos: 2},
+		{name: "default limit", reset: true, saves: defaultCheckpoints + 10, undos: defaultCheckpoints - 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Checkpoints[int]{Limit: tt.limit}
+			if tt.reset {
+				c.Reset(0)
+			}
+			for i := 1; i <= tt.saves; i++ {
+				c.Save(i)
+			}
+
+			undos := 0
+			for c.CanUndo() {
+				state, ok := c.Undo()
+				if !ok {
+					t.Fatal("Undo failed even though CanUndo is true")
+				}
+				if want := tt.saves - 1 - undos; state != want {
+					t.Fatalf("undo %d went back to %d, want %d", undos+1, state, want)
+				}
+				undos++
+			}
+
+			if undos != tt.undos {
+				t.Errorf("undid %d times, want %d", undos, tt.undos)
+			}
+			if _, ok := c.Undo(); ok {
+				t.Error("Undo succeeded even though CanUndo is false")
+			}
+		})
+	}
+}
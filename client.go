@@ -2,10 +2,12 @@ package games
 
 import (
 	"encoding/binary"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/samclaus/games/protocol"
 )
 
 // NOTE: these constants and almost all of the readPump/writePump code are ripped
@@ -42,38 +44,107 @@ type Client struct {
 	// it will introduce race conditions.
 	ID uuid.UUID
 
-	// Name is the player's display name that they provided when opening the
-	// WebSocket. Must be threadsafe, i.e., this field should be treated as
-	// read-only and mutating it will introduce race conditions.
+	// Name is the player's display name, which they provided when opening the
+	// WebSocket and may change with the /name chat command. ONLY SAFE TO USE FROM
+	// THE ROOM'S PROCESSING GOROUTINE, and games should treat it as read-only.
 	Name string
 
-	conn *websocket.Conn
-	room *room       // The room this connection belongs to
-	send chan []byte // Buffered channel of outgoing messages
+	conn  *websocket.Conn
+	room  *room      // The room this connection belongs to
+	queue *sendQueue // Outgoing messages waiting for the write goroutine
 
+	// enc is how messages sent to the client are encoded. Read-only after the client is
+	// created, so it is safe for the write goroutine.
+	enc encoding
+
+	// sequenced is true if the client asked for every message to be prefixed with a
+	// uint32 sequence number so that it can resume its session after reconnecting.
+	// Read-only after the client is created, so it is safe for the write goroutine.
+	sequenced bool
+
+	// resumeFrom is the last sequence number the client saw on a previous connection,
+	// or 0 if it is not attempting to resume a session
+	resumeFrom uint32
+
+	// compressMin is the size in bytes at or above which messages are compressed; wire
+	// counts the bytes written to the network so we can tell how well compression is
+	// working, and is nil if compression is disabled. Both fields are only used by the
+	// write goroutine.
+	compressMin int
+	wire        *countingConn
+	metrics     *metrics
+
+	// session is non-nil for sequenced clients; ONLY SAFE TO USE FROM THE ROOM'S
+	// PROCESSING GOROUTINE!
+	session *session
+
+	// channels are the chat channels defined by the current game which the client was
+	// last told it can see; ONLY SAFE TO USE FROM THE ROOM'S PROCESSING GOROUTINE!
+	channels []protocol.Channel
 }
 
 // Send attempts to send a message to the client, kicking the client from the
-// room if the client's send channel is full/blocked. THIS IS ONLY SAFE TO CALL
-// FROM THE ROOM'S PROCESSING GOROUTINE!
+// room if too many messages are already waiting to be written to it (see
+// SlowClientPolicy). THIS IS ONLY SAFE TO CALL FROM THE ROOM'S PROCESSING GOROUTINE!
 func (c *Client) Send(msg []byte) {
-	select {
-	case c.send <- msg:
-		c.room.debug("Sent %d bytes to %q", len(msg), c.Name)
-	default:
-		c.room.debug("Send channel blocked for %q", c.Name)
-
-		// If this client's send channel, which uses a sizeable buffer,
-		// is blocked, it means this client is being way too slow to
-		// receive events and needs to be disconnected so we can reclaim
-		// resources (the game would literally be unplayable for the user)
-		c.room.removeMember(c)
+	c.sendGameMessage(msg, false)
+}
+
+// SendSnapshot is like Send, but marks the message as a snapshot that completely
+// supersedes any earlier snapshot of the same kind, i.e., with the same scope and
+// message type header bytes. If an older snapshot is still waiting to be written
+// to the client, it gets dropped rather than counting towards the client being too
+// slow. Only use this for messages which carry full state, not incremental updates!
+// THIS IS ONLY SAFE TO CALL FROM THE ROOM'S PROCESSING GOROUTINE!
+func (c *Client) SendSnapshot(msg []byte) {
+	c.sendGameMessage(msg, true)
+}
+
+// sendGameMessage converts a binary game-scope message to the client's encoding, if
+// necessary, and queues it.
+func (c *Client) sendGameMessage(msg []byte, snapshot bool) {
+	kind := kindOf(msg)
+	if c.enc == encodingJSON {
+		msg = c.room.appendGameMessage(nil, c.enc, msg)
+	}
+	c.enqueue(newOutgoing(msg, kind, snapshot))
+}
+
+func (c *Client) enqueue(out outgoing) {
+	if c.session != nil {
+		out.seq = c.session.record(out.msg)
+
+		// The connection died but the client may come back, at which point they
+		// will get this message out of the replay buffer
+		if c.session.detached() {
+			c.room.debug("Buffered %d bytes for detached %q", out.size, c.Name)
+			return
+		}
+	}
+
+	queued, queuedBytes := c.queue.push(out)
+	if queued < 0 {
+		return // already being removed from the room
+	}
+
+	c.room.debug("Queued %d bytes for %q", out.size, c.Name)
+
+	if c.room.slowClients.tooSlow(queued, queuedBytes) {
+		c.room.debug("Too many messages queued for %q (%d, %d bytes)", c.Name, queued, queuedBytes)
+
+		// If this many messages are piling up, it means this client
+		// is being way too slow to receive events and needs to be
+		// disconnected so we can reclaim resources (the game would
+		// literally be unplayable for the user)
+		c.room.evict(c, closeSlowClient)
 	}
 }
 
 func (c *Client) readPump() {
+	room := c.room
+
 	defer func() {
-		c.room.unregister <- c
+		room.leave(c)
 		c.conn.Close()
 	}()
 
@@ -88,11 +159,13 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, msg, err := c.conn.ReadMessage()
+		msgType, msg, err := c.conn.ReadMessage()
 		if err != nil {
 			break
 		}
-		c.room.requests <- request{c, msg}
+		if !room.submit(request{c, msg, msgType == websocket.TextMessage}) {
+			break
+		}
 	}
 }
 
@@ -104,29 +177,40 @@ func (c *Client) writePump() {
 		c.conn.Close()
 	}()
 
+	var batch []outgoing
+
 	for {
 		select {
-		case msg, chanStillOpen := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(sendToClientWait))
+		case <-c.queue.ready:
+			var closed bool
+			var closeMsg []byte
+
+			batch, closed, closeMsg = c.queue.take(batch[:0])
 
-			// The room can decide to kill this connection by closing our send channel,
+			// The room can decide to kill this connection by closing our queue,
 			// which is potentially useful for situations where the server is overloaded
 			// or a client is behaving weirdly.
 			//
 			// Calling Close() on the WebSocket does NOT send a 'proper' close message
 			// to the client, so we do it here (otherwise the client would see it as
 			// an abnormal closure because the connection would just die without warning)
-			if !chanStillOpen {
-				c.conn.WriteMessage(websocket.CloseMessage, nil)
+			if closed {
+				c.conn.SetWriteDeadline(time.Now().Add(sendToClientWait))
+				c.conn.WriteMessage(websocket.CloseMessage, closeMsg)
 				return
 			}
 
-			if err := c.conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
-				debug("Failed to write %d bytes to %q: %v", len(msg), c.Name, err)
-				return
-			}
+			for i, out := range batch {
+				c.conn.SetWriteDeadline(time.Now().Add(sendToClientWait))
+
+				if err := c.writeMessage(out); err != nil {
+					debug("Failed to write %d bytes to %s: %v", out.size, c.ID, err)
+					return
+				}
 
-			debug("Wrote %d bytes to %q", len(msg), c.Name)
+				debug("Wrote %d bytes to %s", out.size, c.ID)
+				batch[i] = outgoing{} // let the GC have it
+			}
 		case <-pingTicker.C:
 			now := time.Now()
 
@@ -139,3 +223,61 @@ func (c *Client) writePump() {
 		}
 	}
 }
+
+// writeMessage writes a single binary WebSocket message, prefixed with its sequence
+// number if the client asked for sequencing. Unsequenced clients get the prepared
+// frame for broadcasts, if there is one.
+func (c *Client) writeMessage(out outgoing) error {
+	if c.wire == nil {
+		return c.writeFrame(out)
+	}
+
+	compress := out.size >= c.compressMin
+	c.conn.EnableWriteCompression(compress)
+
+	before := c.wire.written.Load()
+	err := c.writeFrame(out)
+
+	if compress && err == nil {
+		c.metrics.recordCompressed(out.size, int(c.wire.written.Load()-before))
+	}
+
+	return err
+}
+
+func (c *Client) writeFrame(out outgoing) error {
+	if !c.sequenced {
+		if out.prepared != nil {
+			return c.conn.WritePreparedMessage(out.prepared)
+		}
+		return c.conn.WriteMessage(c.enc.frameType(), out.msg)
+	}
+
+	w, err := c.conn.NextWriter(c.enc.frameType())
+	if err != nil {
+		return err
+	}
+
+	var header []byte
+	msg := out.msg
+
+	if c.enc == encodingJSON {
+		// Splice the sequence number in as the first key of the JSON object, which
+		// works because every JSON message is an object with at least one key
+		var seqBuff [20]byte
+		header = append(strconv.AppendUint(append(seqBuff[:0], `{"seq":`...), uint64(out.seq), 10), ',')
+		msg = msg[1:]
+	} else {
+		var seqBuff [4]byte
+		binary.BigEndian.PutUint32(seqBuff[:], out.seq)
+		header = seqBuff[:]
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
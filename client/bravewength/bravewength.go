@@ -0,0 +1,220 @@
+// Package bravewength decodes the state messages of the Bravewength game (see
+// github.com/samclaus/games/bravewength) for the client package, and builds its requests.
+package bravewength
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/client"
+	"github.com/samclaus/games/wire"
+)
+
+// GameID is the ID of the game on the server.
+const GameID = "samclaus/bravewength"
+
+// BoardSize is the number of cards on the board, which is 5x5.
+const BoardSize = 25
+
+// Role is the role of a player.
+type Role uint8
+
+const (
+	Spectator Role = iota
+	PurpleSeeker
+	PurpleKnower
+	TealSeeker
+	TealKnower
+)
+
+func (r Role) IsSeeker() bool {
+	return r == PurpleSeeker || r == TealSeeker
+}
+
+func (r Role) IsKnower() bool {
+	return r == PurpleKnower || r == TealKnower
+}
+
+// Team is the team the role is on.
+func (r Role) Team() Team {
+	switch r {
+	case PurpleSeeker, PurpleKnower:
+		return TeamPurple
+	case TealSeeker, TealKnower:
+		return TeamTeal
+	}
+	return TeamNone
+}
+
+// Team is one of the two teams, or neither.
+type Team uint8
+
+const (
+	TeamNone Team = iota
+	TeamTeal
+	TeamPurple
+)
+
+// CardType is the type of a card on the board.
+type CardType uint8
+
+const (
+	CardNeutral CardType = iota
+	CardTeal
+	CardPurple
+	CardBlack
+	CardHidden // type is not known to the client
+)
+
+// EventKind is the kind of a game log entry.
+type EventKind uint8
+
+const (
+	EventGameStarted EventKind = iota
+	EventGameEnded
+	EventClueGiven
+	EventCardRevealed
+	EventTurnEnded
+)
+
+// Board is the state of the board, sent whenever anything about it changes.
+type Board struct {
+	Words [BoardSize]string
+	// Discovered is the type of every card that has been revealed, and CardHidden for
+	// the rest.
+	Discovered [BoardSize]CardType
+	// Layout is the type of every card, but only for knowers and once the game has
+	// ended; it is all CardHidden otherwise.
+	Layout [BoardSize]CardType
+	Turn   Role   // role whose turn it is
+	Clue   string // current clue, for the seekers
+	Ended  bool
+	Winner Team // TeamNone if the game was ended early
+	Log    []LogEntry
+}
+
+// LogEntry is an entry of the game log. Clue is only set for EventClueGiven, and Word
+// and CardType for EventCardRevealed.
+type LogEntry struct {
+	Src      uuid.UUID
+	Role     Role
+	Kind     EventKind
+	Clue     string
+	Word     string
+	CardType CardType
+}
+
+// Roles is the role of every player who is not a spectator, sent whenever a role
+// changes.
+type Roles map[uuid.UUID]Role
+
+const (
+	stateBoard byte = iota
+	stateRoles
+)
+
+const (
+	reqSetRole byte = iota
+	reqRandomizeTeams
+	reqNewGame
+	reqEndGame
+	reqGiveClue
+	reqRevealCard
+	reqEndTurn
+)
+
+type decoder struct{}
+
+// Decoder returns the decoder for Bravewength, whose states are a *Board or a Roles.
+func Decoder() client.GameDecoder {
+	return decoder{}
+}
+
+func (decoder) GameID() string {
+	return GameID
+}
+
+func (decoder) DecodeState(body []byte) (any, error) {
+	r := wire.NewVarintReader(body)
+
+	switch typ := r.U8(); typ {
+	case stateBoard:
+		b := &Board{}
+		for i := range b.Words {
+			b.Words[i] = r.Str()
+		}
+		for i := range b.Discovered {
+			b.Discovered[i] = CardType(r.U8())
+		}
+		for i := range b.Layout {
+			b.Layout[i] = CardType(r.U8())
+		}
+		b.Turn = Role(r.U8())
+		b.Clue = r.Str()
+		b.Ended = r.Bool()
+		b.Winner = Team(r.U8())
+
+		for r.Err() == nil && r.Len() > 0 {
+			b.Log = append(b.Log, LogEntry{
+				Src:      r.UUID(),
+				Role:     Role(r.U8()),
+				Kind:     EventKind(r.U8()),
+				Clue:     r.Str(),
+				Word:     r.Str(),
+				CardType: CardType(r.U8()),
+			})
+		}
+
+		return b, r.Done()
+
+	case stateRoles:
+		roles := make(Roles)
+		for r.Err() == nil && r.Len() > 0 {
+			id := r.UUID()
+			roles[id] = Role(r.U8())
+		}
+		return roles, r.Done()
+
+	default:
+		if err := r.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("bravewength: unknown state type %d", typ)
+	}
+}
+
+// SetRole builds a request to change the player's role. Knowers may not stop being
+// knowers while a game is in progress.
+func SetRole(role Role) []byte {
+	return []byte{reqSetRole, byte(role)}
+}
+
+// RandomizeTeams builds a request to randomize the teams, while no game is in progress.
+func RandomizeTeams() []byte {
+	return []byte{reqRandomizeTeams}
+}
+
+// NewGame builds a request to start a new game, abandoning the current one.
+func NewGame() []byte {
+	return []byte{reqNewGame}
+}
+
+// EndGame builds a request to end the current game without a winner.
+func EndGame() []byte {
+	return []byte{reqEndGame}
+}
+
+// GiveClue builds a request to give a clue, as the knower whose turn it is.
+func GiveClue(clue string) []byte {
+	return append([]byte{reqGiveClue}, clue...)
+}
+
+// RevealCard builds a request to reveal a card, as a seeker whose turn it is.
+func RevealCard(index int) []byte {
+	return []byte{reqRevealCard, byte(index)}
+}
+
+// EndTurn builds a request to end the turn, as a seeker whose turn it is.
+func EndTurn() []byte {
+	return []byte{reqEndTurn}
+}
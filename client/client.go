@@ -0,0 +1,311 @@
+// Package client is a Go client for servers built with github.com/samclaus/games. It
+// joins a room over a WebSocket, decodes everything the server sends into typed events,
+// and has methods for every room-scope request. Game-scope messages are handed to a
+// GameDecoder for whichever game is booted; see the subpackages for the games in this
+// repository.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/samclaus/games/protocol"
+)
+
+const (
+	idCookieName       = "id"
+	defaultEventBuffer = 64
+	writeWait          = 10 * time.Second
+)
+
+// Config says how to join a room.
+type Config struct {
+	// URL is the address of the server's HandleJoinRoom endpoint, e.g.,
+	// "ws://localhost:8080/join".
+	URL string
+	// Room is the ID of the room to join, or "new" to create a room named RoomName.
+	Room     string
+	RoomName string
+	// Name is the player's name.
+	Name string
+	// ClientID identifies the player across connections, and is sent to the server as a
+	// cookie. If it is uuid.Nil, a random ID is used.
+	ClientID uuid.UUID
+	// Games are the decoders for game-scope messages, one per game ID. Messages for
+	// games without a decoder are delivered undecoded.
+	Games []GameDecoder
+	// Dialer is used to connect, or websocket.DefaultDialer if nil. Its Subprotocols
+	// are ignored.
+	Dialer *websocket.Dialer
+	// EventBuffer is the capacity of the events channel, 64 if zero. Nothing is read
+	// from the connection while the channel is full, so a client which falls too far
+	// behind will eventually get disconnected by the server.
+	EventBuffer int
+}
+
+// Client is a connection to a room. Its methods are safe to call from multiple
+// goroutines.
+type Client struct {
+	id       uuid.UUID
+	conn     *websocket.Conn
+	version  protocol.Version
+	decoders map[string]GameDecoder
+	events   chan Event
+	writeMtx sync.Mutex
+	closing  atomic.Bool
+	err      error // only valid once events is closed
+}
+
+// Dial joins a room. The first event is always an Init.
+func Dial(ctx context.Context, cfg Config) (*Client, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	q := u.Query()
+	q.Set("room", cfg.Room)
+	q.Set("name", cfg.Name)
+	if cfg.Room == "new" {
+		q.Set("room-name", cfg.RoomName)
+	}
+	u.RawQuery = q.Encode()
+
+	dialer := websocket.DefaultDialer
+	if cfg.Dialer != nil {
+		dialer = cfg.Dialer
+	}
+	d := *dialer
+	d.Subprotocols = []string{protocol.SubprotocolBinaryV2, protocol.SubprotocolBinary}
+
+	id := cfg.ClientID
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+
+	header := make(http.Header)
+	header.Set("Cookie", (&http.Cookie{Name: idCookieName, Value: id.String()}).String())
+
+	conn, res, err := d.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if res != nil {
+			return nil, fmt.Errorf("client: joining room: %w (%s)", err, res.Status)
+		}
+		return nil, fmt.Errorf("client: joining room: %w", err)
+	}
+
+	eventBuffer := cfg.EventBuffer
+	if eventBuffer == 0 {
+		eventBuffer = defaultEventBuffer
+	}
+
+	c := &Client{
+		id:       id,
+		conn:     conn,
+		version:  protocol.Version1,
+		decoders: make(map[string]GameDecoder, len(cfg.Games)),
+		events:   make(chan Event, eventBuffer),
+	}
+	if conn.Subprotocol() == protocol.SubprotocolBinaryV2 {
+		c.version = protocol.Version2
+	}
+	for _, d := range cfg.Games {
+		c.decoders[d.GameID()] = d
+	}
+
+	go c.readLoop()
+	return c, nil
+}
+
+// ID is the player's client ID.
+func (c *Client) ID() uuid.UUID {
+	return c.id
+}
+
+// Events is the channel every event is delivered on, in the order the server sent
+// them. It gets closed when the connection is, after which Err says why.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// Err returns why the connection closed, which is only valid once the events channel
+// has been closed, and is nil if it was closed by calling Close. If the server closed
+// the connection, it is a *websocket.CloseError whose code says why (see the codes in
+// the games package).
+func (c *Client) Err() error {
+	return c.err
+}
+
+// Close leaves the room. The events channel gets closed once the server acknowledges,
+// or after a timeout if it doesn't.
+func (c *Client) Close() error {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	c.closing.Store(true)
+	c.conn.SetReadDeadline(time.Now().Add(writeWait))
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+// BootGame asks the room to boot a game, if none is booted.
+func (c *Client) BootGame(gameID string) error {
+	return c.sendRoom(&protocol.BootGameRequest{GameID: gameID})
+}
+
+// KillGame asks the room to kill the current game, if there is one.
+func (c *Client) KillGame() error {
+	return c.sendRoom(&protocol.KillGameRequest{})
+}
+
+// PauseGame asks the room to pause the current game. Unless the client is the host,
+// this is a vote, and the game is paused once a majority of members vote to.
+func (c *Client) PauseGame() error {
+	return c.sendRoom(&protocol.PauseGameRequest{})
+}
+
+// ResumeGame asks the room to resume the current game. Unless the client is the host,
+// this is a vote, and the game is resumed once a majority of members vote to.
+func (c *Client) ResumeGame() error {
+	return c.sendRoom(&protocol.ResumeGameRequest{})
+}
+
+// Undo asks the room to undo the last move in the current game. Unless the client is
+// the host, this is a vote, and the move is undone once a majority of members vote to.
+func (c *Client) Undo() error {
+	return c.sendRoom(&protocol.UndoRequest{})
+}
+
+// Chat sends a message to the room's global chat channel.
+func (c *Client) Chat(content string) error {
+	return c.sendRoom(&protocol.MessageChatRequest{Content: content})
+}
+
+// ChatIn sends a message to a chat channel defined by the current game (see
+// ChannelsSet).
+func (c *Client) ChatIn(channel, content string) error {
+	return c.sendRoom(&protocol.MessageChannelRequest{Channel: channel, Content: content})
+}
+
+// DirectMessage sends a message to another member. It arrives in the channel named by
+// protocol.DirectChannel.
+func (c *Client) DirectMessage(to uuid.UUID, content string) error {
+	return c.sendRoom(&protocol.MessageDirectRequest{To: to, Content: content})
+}
+
+// OlderChat asks for a page of messages from a channel which are older than the
+// message with the given ID, which arrives as an OlderChat event.
+func (c *Client) OlderChat(channel string, before uint64) error {
+	return c.sendRoom(&protocol.OlderChatMessagesRequest{Channel: channel, Before: before})
+}
+
+// React adds a reaction to a message in a channel, or takes it back if the client
+// already reacted with the same emoji.
+func (c *Client) React(channel string, id uint64, emoji string) error {
+	return c.sendRoom(&protocol.ToggleReactionRequest{Channel: channel, ID: id, Emoji: emoji})
+}
+
+// SetModerator makes another member a moderator, or takes it away. Only the host may
+// do this.
+func (c *Client) SetModerator(id uuid.UUID, moderator bool) error {
+	return c.sendRoom(&protocol.SetModeratorRequest{ID: id, Moderator: moderator})
+}
+
+// Mute stops a member from chatting for the given duration (rounded down to the
+// second), or unmutes them if it is zero. Only the host and moderators may do this.
+func (c *Client) Mute(id uuid.UUID, d time.Duration) error {
+	return c.sendRoom(&protocol.MuteMemberRequest{ID: id, Seconds: uint32(d / time.Second)})
+}
+
+// DeleteChatMessage deletes a message from the global channel or one of the current
+// game's channels. Only the host and moderators may do this.
+func (c *Client) DeleteChatMessage(channel string, id uint64) error {
+	return c.sendRoom(&protocol.DeleteChatMessageRequest{Channel: channel, ID: id})
+}
+
+// SendGame sends a request to the current game. The body is entirely up to the game;
+// the decoder subpackages have functions to build each game's requests.
+func (c *Client) SendGame(body []byte) error {
+	msg := make([]byte, 0, 1+len(body))
+	msg = append(msg, protocol.ScopeGame)
+	return c.send(append(msg, body...))
+}
+
+func (c *Client) sendRoom(m protocol.Message) error {
+	return c.send(protocol.AppendBinary(nil, c.version, m))
+}
+
+func (c *Client) send(msg []byte) error {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteMessage(websocket.BinaryMessage, msg)
+}
+
+// readLoop decodes every message from the server until the connection closes.
+func (c *Client) readLoop() {
+	var game GameDecoder // decoder for the current game, if there is one
+	var gameID string
+
+	defer close(c.events)
+	defer c.conn.Close()
+
+	for {
+		typ, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			if !c.closing.Load() {
+				c.err = err
+			}
+			return
+		}
+		if typ != websocket.BinaryMessage || len(msg) == 0 {
+			c.err = errors.New("client: server sent a message which is not binary")
+			return
+		}
+
+		var ev Event
+
+		switch msg[0] {
+		case protocol.ScopeRoom:
+			m, err := protocol.DecodeBinaryState(c.version, msg)
+			if err != nil {
+				c.err = err
+				return
+			}
+			switch m := m.(type) {
+			case *protocol.InitState:
+				gameID = m.GameID
+				game = c.decoders[gameID]
+			case *protocol.SetGameState:
+				gameID = m.GameID
+				game = c.decoders[gameID]
+			}
+			ev = roomEvent(m)
+
+		case protocol.ScopeGame:
+			gm := GameMessage{GameID: gameID, Body: msg[1:]}
+			if game != nil {
+				if gm.State, err = game.DecodeState(gm.Body); err != nil {
+					c.err = fmt.Errorf("client: decoding %s message: %w", gameID, err)
+					return
+				}
+			}
+			ev = gm
+
+		default:
+			c.err = fmt.Errorf("client: server sent a message with unknown scope %d", msg[0])
+			return
+		}
+
+		c.events <- ev
+	}
+}
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/protocol"
+)
+
+// Event is something the server told the client. It is one of Init, MembersSet,
+// MembersDeleted, ModeratorsSet, ChatHistory, OlderChat, ChatReactions, ChatMessage,
+// ChatMessageDeleted, ReactionSet, ChannelsSet, GameSet, GameCrashed, PauseSet,
+// UndoVotesSet, or GameMessage.
+type Event interface {
+	event()
+}
+
+// Init is always the first event, and tells the client about the room it joined.
+type Init struct {
+	RoomID   uint32
+	ClientID uuid.UUID
+	RoomName string
+	GameID   string // empty if no game is booted
+}
+
+// MembersSet updates the given members. Members not included are unchanged.
+type MembersSet struct {
+	Members []protocol.Member
+}
+
+// MembersDeleted means the given members left the room.
+type MembersDeleted struct {
+	IDs []uuid.UUID
+}
+
+// ModeratorsSet says who the room's host and moderators are.
+type ModeratorsSet struct {
+	Host       uuid.UUID
+	Moderators []uuid.UUID
+}
+
+// ChatHistory is the newest few chat messages in a channel, plus how many messages have
+// been sent to it in total. Older messages can be fetched with Client.OlderChat.
+type ChatHistory struct {
+	Channel  string // protocol.GlobalChannel, a game's channel, or a direct channel
+	Total    uint64
+	Messages []protocol.ChatMessage
+}
+
+// OlderChat is a page of chat messages fetched with Client.OlderChat, oldest first.
+// It is empty if there are no older messages left.
+type OlderChat struct {
+	Channel  string
+	Before   uint64
+	Messages []protocol.ChatMessage
+}
+
+// ChatReactions is every reaction to the messages in the ChatHistory or OlderChat event
+// right before it, one per member who reacted. It only comes if some of the messages
+// have reactions.
+type ChatReactions struct {
+	Channel   string
+	Reactions []protocol.Reaction
+}
+
+// ReactionSet lists every member who has reacted to a message with an emoji, after one
+// of them added or took back their reaction. Members is empty if nobody has reacted
+// with the emoji anymore.
+type ReactionSet struct {
+	Channel string
+	ID      uint64
+	Emoji   string
+	Members []uuid.UUID
+}
+
+// ChatMessage is a new chat message. Its Kind says whether a member typed it, or it
+// is a system message or narration from the game (see protocol.ChatPlayer).
+type ChatMessage struct {
+	Channel string // protocol.GlobalChannel, a game's channel, or a direct channel
+	protocol.ChatMessage
+}
+
+// ChatMessageDeleted means a moderator deleted a message. It should be shown as
+// deleted, like messages of kind protocol.ChatDeleted in a ChatHistory, and its
+// reactions are gone.
+type ChatMessageDeleted struct {
+	Channel string
+	ID      uint64
+}
+
+// ChannelsSet lists the chat channels defined by the current game which the client can
+// see, replacing any it was told about before.
+type ChannelsSet struct {
+	Channels []protocol.Channel
+}
+
+// Sent returns when the server got the message.
+func (m ChatMessage) Sent() time.Time {
+	return time.UnixMilli(int64(m.Time))
+}
+
+// GameSet means a game was booted or killed.
+type GameSet struct {
+	GameID string // empty if the game was killed
+}
+
+// GameCrashed means the current game crashed because of a bug in it, so the room shut
+// it down. A GameSet with no game follows.
+type GameCrashed struct {
+	GameID string
+}
+
+// PauseSet says whether the current game is paused, and who voted to pause it (or to
+// resume it, if it is paused). A game always starts out unpaused.
+type PauseSet struct {
+	Paused bool
+	By     uuid.UUID // who paused the game; uuid.Nil if it is not paused
+	Votes  []uuid.UUID
+}
+
+// UndoVotesSet says who voted to undo the last move in the current game. Votes are
+// cleared once the move is undone, or once another move is made.
+type UndoVotesSet struct {
+	Votes []uuid.UUID
+}
+
+// GameMessage is a game-scope state message.
+type GameMessage struct {
+	GameID string // game the message is from
+	Body   []byte // everything after the scope byte
+	// State is what the game's decoder made of the body, or nil if there is no decoder
+	// for the game.
+	State any
+}
+
+func (Init) event()               {}
+func (MembersSet) event()         {}
+func (MembersDeleted) event()     {}
+func (ModeratorsSet) event()      {}
+func (ChatHistory) event()        {}
+func (OlderChat) event()          {}
+func (ChatReactions) event()      {}
+func (ReactionSet) event()        {}
+func (ChatMessage) event()        {}
+func (ChatMessageDeleted) event() {}
+func (ChannelsSet) event()        {}
+func (GameSet) event()            {}
+func (GameCrashed) event()        {}
+func (PauseSet) event()           {}
+func (UndoVotesSet) event()       {}
+func (GameMessage) event()        {}
+
+// roomEvent converts a room-scope state message to an event.
+func roomEvent(m protocol.Message) Event {
+	switch m := m.(type) {
+	case *protocol.InitState:
+		return Init(*m)
+	case *protocol.SetMembersState:
+		return MembersSet{m.Members}
+	case *protocol.DeleteMembersState:
+		return MembersDeleted{m.IDs}
+	case *protocol.SetModeratorsState:
+		return ModeratorsSet{m.Host, m.Moderators}
+	case *protocol.AllChatMessagesState:
+		return ChatHistory{m.Channel, m.History, m.Messages}
+	case *protocol.OlderChatMessagesState:
+		return OlderChat{m.Channel, m.Before, m.Messages}
+	case *protocol.ChatReactionsState:
+		return ChatReactions{m.Channel, m.Reactions}
+	case *protocol.SetReactionState:
+		return ReactionSet{m.Channel, m.ID, m.Emoji, m.Members}
+	case *protocol.NewChatMessageState:
+		return ChatMessage{m.Channel, m.ChatMessage}
+	case *protocol.DeleteChatMessageState:
+		return ChatMessageDeleted{m.Channel, m.ID}
+	case *protocol.SetChannelsState:
+		return ChannelsSet{m.Channels}
+	case *protocol.SetGameState:
+		return GameSet{m.GameID}
+	case *protocol.GameCrashedState:
+		return GameCrashed{m.GameID}
+	case *protocol.SetPauseState:
+		return PauseSet{m.Paused, m.By, m.Votes}
+	case *protocol.SetUndoVotesState:
+		return UndoVotesSet{m.Votes}
+	}
+	panic("client: no event for room-scope " + m.Name() + " message")
+}
+
+// GameDecoder decodes the state messages of one game. Decoders must be safe to use
+// from multiple goroutines.
+type GameDecoder interface {
+	// GameID is the ID of the game, as returned by its Game.ID on the server.
+	GameID() string
+	// DecodeState decodes a game-scope state message, not including the scope byte.
+	DecodeState(body []byte) (any, error)
+}
@@ -0,0 +1,192 @@
+// Package skull decodes the state messages of the Skull game (see
+// github.com/samclaus/games/skull) for the client package, and builds its requests.
+package skull
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/client"
+	"github.com/samclaus/games/wire"
+)
+
+// GameID is the ID of the game on the server.
+const GameID = "samclaus/skull"
+
+// MaxPlayers is the number of seats.
+const MaxPlayers = 6
+
+// Phase is the phase of the game.
+type Phase uint8
+
+const (
+	PhaseNoGame        Phase = iota // nobody has started a game yet
+	PhaseWinner                     // someone won the last game
+	PhaseAborted                    // the last game was aborted without a winner
+	PhasePlay                       // players take turns playing cards until someone bids
+	PhaseBid                        // players take turns raising the bid or passing
+	PhasePick                       // the bidder picks as many cards as they bid
+	PhaseBidderShuffle              // the bidder picked a skull and may shuffle their cards
+	PhaseTakeCard                   // the skull's owner takes a card from the bidder
+)
+
+// Active reports whether a game is in progress.
+func (p Phase) Active() bool {
+	return p > PhaseAborted
+}
+
+// HandStatus says whether a seat is taken.
+type HandStatus uint8
+
+const (
+	HandUnclaimed HandStatus = iota
+	HandClaimed
+	HandLeft // the player left during a game, but their hand is still in it
+)
+
+// Hand is a seat at the table.
+type Hand struct {
+	ID     uuid.UUID // client ID of the player in the seat
+	Status HandStatus
+	Held   uint8 // number of cards held
+	Played uint8 // number of cards played
+	Score  uint8 // number of successful bids; 2 wins the game
+}
+
+// State is the full state of the game, sent whenever anything changes.
+type State struct {
+	Phase  Phase
+	Turn   uint8 // index of the hand whose turn it is
+	Played uint8 // total cards played, which is the highest possible bid
+	Bid    uint8
+	Bidder uint8  // index of the hand that last raised the bid
+	Passed uint16 // bitset of hand indices that passed on the current bid
+	Taker  uint8  // index of the hand whose skull the bidder picked
+	Winner uuid.UUID
+	// Hands has one hand per player while a game is active, and one per seat
+	// otherwise.
+	Hands []Hand
+}
+
+// HandOf returns the index of the hand claimed by the given client, or -1.
+func (s *State) HandOf(id uuid.UUID) int {
+	for i := range s.Hands {
+		if s.Hands[i].Status == HandClaimed && s.Hands[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+const stateFull byte = 0
+
+const (
+	reqJoinGame byte = iota
+	reqLeaveGame
+	reqRestartGame
+	reqAbortGame
+	reqPlay
+	reqBid
+	reqPass
+	reqPick
+	reqMoveCard
+	reqDoneShuffling
+	reqTakeCard
+)
+
+type decoder struct{}
+
+// Decoder returns the decoder for Skull, whose states are a *State.
+func Decoder() client.GameDecoder {
+	return decoder{}
+}
+
+func (decoder) GameID() string {
+	return GameID
+}
+
+func (decoder) DecodeState(body []byte) (any, error) {
+	r := wire.NewVarintReader(body)
+
+	if typ := r.U8(); r.Err() == nil && typ != stateFull {
+		return nil, fmt.Errorf("skull: unknown state type %d", typ)
+	}
+
+	s := &State{
+		Phase:  Phase(r.U8()),
+		Turn:   r.U8(),
+		Played: r.U8(),
+		Bid:    r.U8(),
+		Bidder: r.U8(),
+		Passed: r.U16(),
+		Taker:  r.U8(),
+		Winner: r.UUID(),
+	}
+
+	for r.Err() == nil && r.Len() > 0 {
+		s.Hands = append(s.Hands, Hand{
+			ID:     r.UUID(),
+			Status: HandStatus(r.U8()),
+			Held:   r.U8(),
+			Played: r.U8(),
+			Score:  r.U8(),
+		})
+	}
+
+	return s, r.Done()
+}
+
+// JoinGame builds a request to claim a seat, or switch seats if no game is active.
+func JoinGame(seat int) []byte {
+	return []byte{reqJoinGame, byte(seat)}
+}
+
+// LeaveGame builds a request to give up the player's seat.
+func LeaveGame() []byte {
+	return []byte{reqLeaveGame}
+}
+
+// RestartGame builds a request to start a new game with everyone who has a seat.
+func RestartGame() []byte {
+	return []byte{reqRestartGame}
+}
+
+// AbortGame builds a request to end the current game without a winner.
+func AbortGame() []byte {
+	return []byte{reqAbortGame}
+}
+
+// Play builds a request to play a card from the player's hand.
+func Play(card int) []byte {
+	return []byte{reqPlay, byte(card)}
+}
+
+// Bid builds a request to raise the bid.
+func Bid(bid int) []byte {
+	return []byte{reqBid, byte(bid)}
+}
+
+// Pass builds a request to pass on the current bid.
+func Pass() []byte {
+	return []byte{reqPass}
+}
+
+// Pick builds a request to pick the top played card of a hand, as the bidder.
+func Pick(hand int) []byte {
+	return []byte{reqPick, byte(hand)}
+}
+
+// MoveCard builds a request to swap two cards in the player's hand.
+func MoveCard(from, to int) []byte {
+	return []byte{reqMoveCard, byte(from), byte(to)}
+}
+
+// DoneShuffling builds a request to let the skull's owner take a card, as the bidder.
+func DoneShuffling() []byte {
+	return []byte{reqDoneShuffling}
+}
+
+// TakeCard builds a request to take a card from the bidder, as the skull's owner.
+func TakeCard(card int) []byte {
+	return []byte{reqTakeCard, byte(card)}
+}
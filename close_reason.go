@@ -0,0 +1,52 @@
+package games
+
+import (
+	"github.com/gorilla/websocket"
+)
+
+// closeReason is why the server disconnected a client. Each reason (other than
+// closeNone) is sent to the client as the code of the WebSocket close frame, using
+// the 4000-4999 range reserved for applications, along with a short explanation as
+// the close text so that clients which don't know the code can still show something.
+type closeReason int
+
+// closeNone means the connection is already dead, so no close frame is sent.
+const closeNone closeReason = 0
+
+const (
+	// closeRoomFull means the room already had the maximum number of members.
+	closeRoomFull closeReason = 4000 + iota
+	// closeSlowClient means too many messages piled up for the client; see
+	// SlowClientPolicy.
+	closeSlowClient
+	// closeKicked means another member kicked the client from the room.
+	closeKicked
+	// closeBanned means the client is not allowed back into the room.
+	closeBanned
+	// closeProtocolViolation means the client sent a message the server could not
+	// make sense of.
+	closeProtocolViolation
+	// closeShutdown means the server (or just the room) is shutting down.
+	closeShutdown
+	// closeReplaced means a newer connection resumed the client's session.
+	closeReplaced
+)
+
+var closeReasonText = map[closeReason]string{
+	closeRoomFull:          "Room is full",
+	closeSlowClient:        "Connection too slow to keep up with the room",
+	closeKicked:            "Kicked from the room",
+	closeBanned:            "Banned from the room",
+	closeProtocolViolation: "Sent an invalid message",
+	closeShutdown:          "Room is shutting down",
+	closeReplaced:          "Session resumed by another connection",
+}
+
+// frame returns the payload of the close frame to send for this reason, which is
+// nil for closeNone.
+func (r closeReason) frame() []byte {
+	if r == closeNone {
+		return nil
+	}
+	return websocket.FormatCloseMessage(int(r), closeReasonText[r])
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/samclaus/games/client"
+	"github.com/samclaus/games/client/bravewength"
+	"github.com/samclaus/games/client/skull"
+)
+
+// bravewengthRoles are the roles taken by the first bots in a room; any others watch.
+var bravewengthRoles = [...]bravewength.Role{
+	bravewength.TealKnower,
+	bravewength.TealSeeker,
+	bravewength.PurpleKnower,
+	bravewength.PurpleSeeker,
+}
+
+// bot is a simulated player. The first bot in each room is its host, which boots the
+// room's game and starts new matches.
+type bot struct {
+	cfg   *config
+	stats *stats
+	cli   *client.Client
+	rng   *rand.Rand
+	seat  int    // index of the bot within its room
+	game  string // game the host boots
+	slow  bool   // whether the bot dawdles over every event
+
+	booted      string               // game that is currently booted
+	lastGameMsg time.Time            // when the current game last said anything
+	pending     map[string]time.Time // chat messages sent but not yet echoed back
+	chatCtr     int
+
+	board *bravewength.Board
+	roles bravewength.Roles
+	skull *skull.State
+}
+
+func (b *bot) host() bool {
+	return b.seat == 0
+}
+
+// run handles events and acts every so often until the context is done or the
+// connection closes.
+func (b *bot) run(ctx context.Context) {
+	b.pending = make(map[string]time.Time)
+
+	// Jitter the first tick so the bots in a room don't all act at once
+	time.Sleep(time.Duration(b.rng.Int63n(int64(b.cfg.think))))
+	ticker := time.NewTicker(b.cfg.think)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-b.cli.Events():
+			if !ok {
+				if err := b.cli.Err(); err != nil {
+					b.stats.disconnected(err)
+				}
+				return
+			}
+			b.stats.messages.Add(1)
+			b.handle(ev)
+			if b.slow {
+				time.Sleep(b.cfg.slowDelay)
+			}
+
+		case <-ticker.C:
+			b.act()
+
+		case <-ctx.Done():
+			b.cli.Close()
+			for range b.cli.Events() {
+			}
+			return
+		}
+	}
+}
+
+func (b *bot) handle(ev client.Event) {
+	switch ev := ev.(type) {
+	case client.ChatMessage:
+		if sent, ok := b.pending[ev.Content]; ok && ev.Src == b.cli.ID() {
+			b.stats.roundTrip(time.Since(sent))
+			delete(b.pending, ev.Content)
+		}
+
+	case client.GameSet:
+		b.booted = ev.GameID
+		b.lastGameMsg = time.Now()
+		b.board, b.roles, b.skull = nil, nil, nil
+
+	case client.GameMessage:
+		b.lastGameMsg = time.Now()
+
+		switch st := ev.State.(type) {
+		case *bravewength.Board:
+			b.board = st
+		case bravewength.Roles:
+			b.roles = st
+		case *skull.State:
+			b.skull = st
+		}
+	}
+}
+
+func (b *bot) send(what string, err error) {
+	if err != nil {
+		b.stats.failed("sending "+what, err)
+	}
+}
+
+// act does something random but legal.
+func (b *bot) act() {
+	if b.rng.Float64() < b.cfg.chatRate {
+		b.chatCtr++
+		content := fmt.Sprintf("bot %d says hello #%d", b.seat, b.chatCtr)
+		b.pending[content] = time.Now()
+		b.send("chat", b.cli.Chat(content))
+		return
+	}
+
+	if b.booted == "" {
+		if b.host() {
+			b.send("boot", b.cli.BootGame(b.game))
+		}
+		return
+	}
+
+	// Moves can easily get stuck, e.g., on the turn of a role nobody took, so the host
+	// starts over if the game has been quiet for too long
+	if b.host() && time.Since(b.lastGameMsg) > b.cfg.stall {
+		b.lastGameMsg = time.Now()
+		switch b.booted {
+		case bravewength.GameID:
+			b.send("bravewength request", b.cli.SendGame(bravewength.NewGame()))
+		case skull.GameID:
+			b.send("skull request", b.cli.SendGame(skull.RestartGame()))
+		}
+		return
+	}
+
+	switch b.booted {
+	case bravewength.GameID:
+		if req := b.bravewengthMove(); req != nil {
+			b.send("bravewength request", b.cli.SendGame(req))
+		}
+	case skull.GameID:
+		if req := b.skullMove(); req != nil {
+			b.send("skull request", b.cli.SendGame(req))
+		}
+	}
+}
+
+// bravewengthMove returns a random legal request, or nil if there is nothing to do.
+func (b *bot) bravewengthMove() []byte {
+	if b.board == nil || b.roles == nil {
+		return nil
+	}
+
+	role := b.roles[b.cli.ID()]
+	want := bravewength.Spectator
+	if b.seat < len(bravewengthRoles) {
+		want = bravewengthRoles[b.seat]
+	}
+
+	// Knowers can't give up their role during a game
+	if role != want && (b.board.Ended || !role.IsKnower()) {
+		return bravewength.SetRole(want)
+	}
+
+	if b.board.Ended {
+		if b.host() {
+			return bravewength.NewGame()
+		}
+		return nil
+	}
+	if b.board.Turn != role {
+		return nil
+	}
+
+	if role.IsKnower() {
+		return bravewength.GiveClue(fmt.Sprintf("clue %d", b.rng.Intn(4)+1))
+	}
+
+	hidden := make([]int, 0, bravewength.BoardSize)
+	for i, ct := range b.board.Discovered {
+		if ct == bravewength.CardHidden {
+			hidden = append(hidden, i)
+		}
+	}
+	if len(hidden) == 0 || b.rng.Intn(5) == 0 {
+		return bravewength.EndTurn()
+	}
+	return bravewength.RevealCard(hidden[b.rng.Intn(len(hidden))])
+}
+
+// skullMove returns a random legal request, or nil if there is nothing to do.
+func (b *bot) skullMove() []byte {
+	s := b.skull
+	if s == nil {
+		return nil
+	}
+
+	me := s.HandOf(b.cli.ID())
+
+	if !s.Phase.Active() {
+		if me < 0 && b.seat < skull.MaxPlayers {
+			return skull.JoinGame(b.seat)
+		}
+		if b.host() && claimedHands(s) >= minInt(b.cfg.clients, skull.MaxPlayers) {
+			return skull.RestartGame()
+		}
+		return nil
+	}
+	if me < 0 || int(s.Turn) != me {
+		return nil
+	}
+
+	hand := s.Hands[me]
+	canBid := s.Played > s.Bid
+
+	switch s.Phase {
+	case skull.PhasePlay:
+		if hand.Held > 0 && (!canBid || b.rng.Intn(3) > 0) {
+			return skull.Play(b.rng.Intn(int(hand.Held)))
+		}
+		if canBid {
+			return skull.Bid(b.randomBid(s))
+		}
+
+	case skull.PhaseBid:
+		if canBid && b.rng.Intn(2) == 0 {
+			return skull.Bid(b.randomBid(s))
+		}
+		return skull.Pass()
+
+	case skull.PhasePick:
+		stacks := make([]int, 0, len(s.Hands))
+		for i, h := range s.Hands {
+			if h.Played > 0 {
+				stacks = append(stacks, i)
+			}
+		}
+		if len(stacks) > 0 {
+			return skull.Pick(stacks[b.rng.Intn(len(stacks))])
+		}
+
+	case skull.PhaseBidderShuffle:
+		return skull.DoneShuffling()
+
+	case skull.PhaseTakeCard:
+		if held := s.Hands[s.Bidder].Held; held > 0 {
+			return skull.TakeCard(b.rng.Intn(int(held)))
+		}
+	}
+
+	return nil
+}
+
+// randomBid returns a bid higher than the current one, but no higher than the number of
+// cards played. There must be such a bid.
+func (b *bot) randomBid(s *skull.State) int {
+	return int(s.Bid) + 1 + b.rng.Intn(int(s.Played-s.Bid))
+}
+
+func claimedHands(s *skull.State) int {
+	n := 0
+	for _, h := range s.Hands {
+		if h.Status == skull.HandClaimed {
+			n++
+		}
+	}
+	return n
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// connect joins a room and waits for the init message, returning how long that took.
+func connect(ctx context.Context, cfg *config, room, name string) (*client.Client, client.Init, time.Duration, error) {
+	start := time.Now()
+
+	cli, err := client.Dial(ctx, client.Config{
+		URL:      cfg.url,
+		Room:     room,
+		RoomName: "loadgen",
+		Name:     name,
+		Games:    []client.GameDecoder{bravewength.Decoder(), skull.Decoder()},
+	})
+	if err != nil {
+		return nil, client.Init{}, 0, err
+	}
+
+	select {
+	case ev, ok := <-cli.Events():
+		if !ok {
+			err := cli.Err()
+			if err == nil {
+				err = errors.New("connection closed before init message")
+			}
+			return nil, client.Init{}, 0, err
+		}
+		init, ok := ev.(client.Init)
+		if !ok {
+			cli.Close()
+			return nil, client.Init{}, 0, fmt.Errorf("expected init message but got %T", ev)
+		}
+		return cli, init, time.Since(start), nil
+
+	case <-ctx.Done():
+		cli.Close()
+		return nil, client.Init{}, 0, errors.New("timed out waiting for init message")
+	}
+}
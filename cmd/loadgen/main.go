@@ -0,0 +1,187 @@
+// Command loadgen puts load on a running games server to see how many rooms it can
+// host. It creates a number of rooms, fills each with simulated players which chat,
+// boot games, and play random legal moves, and then reports how long it took to
+// connect, how long chat messages took to come back, and how many players got evicted
+// or ran into errors along the way. For example:
+//
+//	go run ./cmd/loadgen -url ws://localhost:8080/join -rooms 200 -clients 5 -duration 1m
+//
+// Rooms alternate between the games given by -games. Setting -slow makes some players
+// in every room take their time reading, to see how the server treats slow clients.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samclaus/games/client/bravewength"
+	"github.com/samclaus/games/client/skull"
+)
+
+// config is everything set by flags.
+type config struct {
+	url       string
+	rooms     int
+	clients   int
+	games     []string
+	duration  time.Duration
+	think     time.Duration
+	chatRate  float64
+	stall     time.Duration
+	slow      int
+	slowDelay time.Duration
+	report    time.Duration
+}
+
+var gameIDs = map[string]string{
+	"bravewength": bravewength.GameID,
+	"skull":       skull.GameID,
+}
+
+func main() {
+	var cfg config
+	var gameNames string
+
+	flag.StringVar(&cfg.url, "url", "ws://localhost:8080/join", "address of the server's join endpoint")
+	flag.IntVar(&cfg.rooms, "rooms", 10, "number of rooms")
+	flag.IntVar(&cfg.clients, "clients", 4, "number of players in each room")
+	flag.StringVar(&gameNames, "games", "bravewength,skull", "comma-separated games for the rooms to play")
+	flag.DurationVar(&cfg.duration, "duration", 30*time.Second, "how long to run once every room is full")
+	flag.DurationVar(&cfg.think, "think", 500*time.Millisecond, "how often each player acts")
+	flag.Float64Var(&cfg.chatRate, "chat", 0.2, "fraction of actions which are chat messages")
+	flag.DurationVar(&cfg.stall, "stall", 5*time.Second, "how long a game may go quiet before the host starts over")
+	flag.IntVar(&cfg.slow, "slow", 0, "number of players in each room which read slowly")
+	flag.DurationVar(&cfg.slowDelay, "slow-delay", 100*time.Millisecond, "how long slow players take to read each message")
+	flag.DurationVar(&cfg.report, "report", 5*time.Second, "how often to report progress")
+	flag.Parse()
+
+	for _, name := range strings.Split(gameNames, ",") {
+		id, ok := gameIDs[strings.TrimSpace(name)]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown game %q\n", name)
+			os.Exit(2)
+		}
+		cfg.games = append(cfg.games, id)
+	}
+	if cfg.rooms < 1 || cfg.clients < 1 || cfg.think <= 0 {
+		fmt.Fprintln(os.Stderr, "-rooms, -clients and -think must be positive")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	st := newStats()
+	start := time.Now()
+	run(ctx, &cfg, st)
+	st.report(os.Stdout, time.Since(start))
+}
+
+// run fills every room, lets the players play for the configured duration, and waits
+// for them all to disconnect.
+func run(ctx context.Context, cfg *config, st *stats) {
+	playCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var joined, done sync.WaitGroup
+	start := time.Now()
+
+	for i := 0; i < cfg.rooms; i++ {
+		joined.Add(1)
+		go fillRoom(playCtx, cfg, st, i, &joined, &done)
+	}
+
+	joined.Wait()
+	fmt.Printf("Filled %d rooms in %v\n", cfg.rooms, time.Since(start).Round(time.Millisecond))
+
+	ticker := time.NewTicker(cfg.report)
+	defer ticker.Stop()
+	timeout := time.After(cfg.duration)
+
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			st.progress(os.Stdout, time.Since(start))
+		case <-timeout:
+			break loop
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	cancel()
+	done.Wait()
+}
+
+// fillRoom creates a room, connects every player to it, and then starts a bot for each
+// player that managed to connect.
+func fillRoom(ctx context.Context, cfg *config, st *stats, index int, joined, done *sync.WaitGroup) {
+	defer joined.Done()
+
+	connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	// The host has to create the room before anyone can join it
+	host, roomID := join(connectCtx, cfg, st, index, 0, "new")
+	if host == nil {
+		return
+	}
+	host.game = cfg.games[index%len(cfg.games)]
+
+	room := strconv.FormatUint(uint64(roomID), 10)
+	bots := []*bot{host}
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+
+	for seat := 1; seat < cfg.clients; seat++ {
+		wg.Add(1)
+		go func(seat int) {
+			defer wg.Done()
+
+			if b, _ := join(connectCtx, cfg, st, index, seat, room); b != nil {
+				mtx.Lock()
+				bots = append(bots, b)
+				mtx.Unlock()
+			}
+		}(seat)
+	}
+	wg.Wait()
+
+	for _, b := range bots {
+		done.Add(1)
+		go func(b *bot) {
+			defer done.Done()
+			b.run(ctx)
+		}(b)
+	}
+}
+
+// join connects a player to a room, returning its bot (which has not been started yet)
+// and the room ID, or nil if it could not connect.
+func join(ctx context.Context, cfg *config, st *stats, index, seat int, room string) (*bot, uint32) {
+	cli, init, latency, err := connect(ctx, cfg, room, fmt.Sprintf("bot %d.%d", index, seat))
+	if err != nil {
+		st.failed("connecting", err)
+		return nil, 0
+	}
+	st.connected(latency)
+
+	return &bot{
+		cfg:    cfg,
+		stats:  st,
+		cli:    cli,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano() + int64(index*cfg.clients+seat))),
+		seat:   seat,
+		slow:   seat >= cfg.clients-cfg.slow,
+		booted: init.GameID,
+	}, init.RoomID
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stats collects measurements from every bot. All of its methods are safe to call
+// from multiple goroutines.
+type stats struct {
+	messages atomic.Uint64 // events received by all bots
+
+	mtx       sync.Mutex
+	connects  []time.Duration
+	rtts      []time.Duration
+	evictions map[int]int // by close code
+	errors    map[string]int
+}
+
+func newStats() *stats {
+	return &stats{
+		evictions: make(map[int]int),
+		errors:    make(map[string]int),
+	}
+}
+
+func (s *stats) connected(latency time.Duration) {
+	s.mtx.Lock()
+	s.connects = append(s.connects, latency)
+	s.mtx.Unlock()
+}
+
+func (s *stats) roundTrip(rtt time.Duration) {
+	s.mtx.Lock()
+	s.rtts = append(s.rtts, rtt)
+	s.mtx.Unlock()
+}
+
+// disconnected records why a bot's connection closed before the end of the run. Close
+// codes in the range the games server uses for its own reasons count as evictions, and
+// anything else counts as an error.
+func (s *stats) disconnected(err error) {
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) && ce.Code >= 4000 && ce.Code < 5000 {
+		s.mtx.Lock()
+		s.evictions[ce.Code]++
+		s.mtx.Unlock()
+		return
+	}
+	s.failed("disconnected", err)
+}
+
+// failed records an error, grouping errors by what was being done and what went wrong.
+func (s *stats) failed(op string, err error) {
+	s.mtx.Lock()
+	s.errors[op+": "+err.Error()]++
+	s.mtx.Unlock()
+}
+
+// progress writes a one-line summary of the run so far.
+func (s *stats) progress(w io.Writer, elapsed time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	fmt.Fprintf(w, "%6s  connected %d  messages %d  rtt p50 %v  p99 %v  evictions %d  errors %d\n",
+		elapsed.Round(time.Second),
+		len(s.connects),
+		s.messages.Load(),
+		percentile(s.rtts, 50),
+		percentile(s.rtts, 99),
+		total(s.evictions),
+		total(s.errors),
+	)
+}
+
+// report writes the final results of the run.
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	msgs := s.messages.Load()
+
+	fmt.Fprintf(w, "\nRan for %v\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "Connect latency:  %s\n", summary(s.connects))
+	fmt.Fprintf(w, "Chat round trip:  %s\n", summary(s.rtts))
+	fmt.Fprintf(w, "Messages:         %d received (%.0f/s)\n", msgs, float64(msgs)/elapsed.Seconds())
+
+	fmt.Fprintf(w, "Evictions:        %d\n", total(s.evictions))
+	for _, code := range sortedKeys(s.evictions) {
+		fmt.Fprintf(w, "  %6d  close code %d\n", s.evictions[code], code)
+	}
+
+	fmt.Fprintf(w, "Errors:           %d\n", total(s.errors))
+	for _, msg := range sortedKeys(s.errors) {
+		fmt.Fprintf(w, "  %6d  %s\n", s.errors[msg], msg)
+	}
+}
+
+func summary(samples []time.Duration) string {
+	if len(samples) == 0 {
+		return "no samples"
+	}
+	return fmt.Sprintf("n=%d  p50 %v  p90 %v  p99 %v  max %v",
+		len(samples),
+		percentile(samples, 50),
+		percentile(samples, 90),
+		percentile(samples, 99),
+		percentile(samples, 100),
+	)
+}
+
+// percentile sorts the samples in place and returns the given percentile, rounded to
+// make it readable.
+func percentile(samples []time.Duration, p int) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	i := (len(samples)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return samples[i].Round(10 * time.Microsecond)
+}
+
+func total[K comparable](counts map[K]int) int {
+	n := 0
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
+
+func sortedKeys[K int | string](m map[K]int) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
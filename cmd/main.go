@@ -21,6 +21,7 @@ func main() {
 
 	mux.HandleFunc("/rooms", s.HandleGetRooms)
 	mux.HandleFunc("/join", s.HandleJoinRoom)
+	mux.HandleFunc("/metrics", s.HandleMetrics)
 
 	http.ListenAndServe(":8080", mux)
 }
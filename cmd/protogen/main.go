@@ -0,0 +1,88 @@
+// Command protogen generates TypeScript types, decoders and encoders for the room
+// protocol and the protocol of every game in this module, from their machine-readable
+// descriptions (protocol/room.json and each game's protocol.json).
+//
+// Before generating anything, it checks every description against the Go code, and
+// exits with an error if they disagree. Run it with -check to only do that, e.g., in CI:
+//
+//	go run ./cmd/protogen -check
+//	go run ./cmd/protogen -out ../frontend/src/protocol
+package main
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/samclaus/games"
+	"github.com/samclaus/games/bravewength"
+	"github.com/samclaus/games/protocol"
+	"github.com/samclaus/games/skull"
+)
+
+//go:embed wire.ts
+var wireTS []byte
+
+func main() {
+	out := flag.String("out", "ts", "directory to write TypeScript files to")
+	checkOnly := flag.Bool("check", false, "only check the descriptions against the Go code")
+	flag.Parse()
+
+	schemas, err := checkedSchemas(
+		bravewength.Game(nil).(games.DescribedGame),
+		skull.Game().(games.DescribedGame),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *checkOnly {
+		return
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(filepath.Join(*out, "wire.ts"), wireTS, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, s := range schemas {
+		ts, err := generateTypeScript(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", s.Name, err)
+			os.Exit(1)
+		}
+
+		// "samclaus/bravewength" goes in bravewength.ts
+		file := filepath.Join(*out, path.Base(s.Name)+".ts")
+		if err := os.WriteFile(file, ts, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// checkedSchemas returns the room schema followed by the schema of each game, making sure
+// each of them agrees with the Go code first.
+func checkedSchemas(gs ...games.DescribedGame) ([]protocol.Schema, error) {
+	if err := protocol.CheckRoomSchema(); err != nil {
+		return nil, err
+	}
+
+	schemas := []protocol.Schema{protocol.RoomSchema()}
+
+	for _, g := range gs {
+		if err := games.CheckProtocol(g); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, g.Protocol())
+	}
+
+	return schemas, nil
+}
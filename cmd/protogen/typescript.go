@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samclaus/games/protocol"
+)
+
+// tsFile accumulates a generated TypeScript file.
+type tsFile struct {
+	sb  strings.Builder
+	err error
+	// strVersion is the argument passed to every str() call, which overrides the
+	// version of the reader or writer for games whose messages are always the same
+	// version (see protocol.Schema.Version); empty for the room protocol.
+	strVersion string
+	// usesVersion is set once strVersion has actually been used, so Version only gets
+	// imported when it is needed.
+	usesVersion bool
+}
+
+func (f *tsFile) line(indent int, format string, args ...any) {
+	f.sb.WriteString(strings.Repeat("    ", indent))
+	fmt.Fprintf(&f.sb, format, args...)
+	f.sb.WriteByte('\n')
+}
+
+func (f *tsFile) doc(indent int, doc string) {
+	if doc != "" {
+		f.line(indent, "/** %s */", doc)
+	}
+}
+
+func (f *tsFile) fail(format string, args ...any) {
+	if f.err == nil {
+		f.err = fmt.Errorf(format, args...)
+	}
+}
+
+// generateTypeScript generates types for every message of a protocol, a decodeState()
+// function, and an encodeRequest() function.
+func generateTypeScript(s protocol.Schema) ([]byte, error) {
+	var f tsFile
+	if s.Version >= protocol.Version2 {
+		f.strVersion = fmt.Sprintf("Version.V%d", s.Version)
+	}
+
+	f.line(0, "export const SCOPE = %d;", scopeByte(s))
+	f.line(0, "")
+
+	f.types(s.States, "State")
+	f.types(s.Requests, "Request")
+
+	f.line(0, "/** Decodes a state message, starting right after the scope byte. */")
+	f.line(0, "export function decodeState(r: Reader): State {")
+	f.line(1, "const type = r.u8();")
+	f.line(1, "switch (type) {")
+	for _, ms := range s.States {
+		f.line(2, "case %d:", ms.Type)
+		f.line(3, "return {")
+		f.line(4, "type: %q,", ms.Name)
+		for _, fld := range ms.Fields {
+			f.line(4, "%s: %s,", fld.Name, f.decodeExpr(fld))
+		}
+		f.line(3, "};")
+	}
+	f.line(1, "}")
+	f.line(1, "throw new Error(`unknown %s state type ${type}`);", s.Name)
+	f.line(0, "}")
+	f.line(0, "")
+
+	f.line(0, "/** Encodes a request, including the scope byte. */")
+	f.line(0, "export function encodeRequest(w: Writer, m: Request): void {")
+	f.line(1, "w.u8(SCOPE);")
+	f.line(1, "switch (m.type) {")
+	for _, ms := range s.Requests {
+		f.line(2, "case %q:", ms.Name)
+		f.line(3, "w.u8(%d);", ms.Type)
+		for _, fld := range ms.Fields {
+			f.encodeStmts(3, fld, "m."+fld.Name)
+		}
+		f.line(3, "return;")
+	}
+	f.line(1, "}")
+	f.line(0, "}")
+
+	// The imports depend on what the rest of the file turned out to use
+	imports := "Reader, Writer"
+	if f.usesVersion {
+		imports = "Reader, Version, Writer"
+	}
+	header := fmt.Sprintf("// Code generated by protogen from the %q protocol. DO NOT EDIT.\n\nimport { %s } from \"./wire\";\n\n", s.Name, imports)
+
+	return []byte(header + f.sb.String()), f.err
+}
+
+func scopeByte(s protocol.Schema) byte {
+	if s.Scope == "game" {
+		return protocol.ScopeGame
+	}
+	return protocol.ScopeRoom
+}
+
+// types generates an interface for each message plus a union of all of them.
+func (f *tsFile) types(msgs []protocol.MessageSchema, suffix string) {
+	names := make([]string, len(msgs))
+
+	for i, ms := range msgs {
+		names[i] = tsName(ms.Name) + suffix
+
+		f.doc(0, ms.Doc)
+		f.line(0, "export interface %s {", names[i])
+		f.line(1, "type: %q;", ms.Name)
+		for _, fld := range ms.Fields {
+			f.doc(1, fld.Doc)
+			f.line(1, "%s: %s;", fld.Name, f.tsType(fld))
+		}
+		f.line(0, "}")
+		f.line(0, "")
+	}
+
+	if len(names) == 0 {
+		f.line(0, "export type %s = never;", suffix)
+	} else {
+		f.line(0, "export type %s = %s;", suffix, strings.Join(names, " | "))
+	}
+	f.line(0, "")
+}
+
+// tsName converts snake_case to PascalCase.
+func tsName(name string) string {
+	parts := strings.Split(name, "_")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func (f *tsFile) tsType(fld protocol.Field) string {
+	switch fld.Kind {
+	case protocol.KindU8, protocol.KindU16, protocol.KindU32, protocol.KindU64, protocol.KindNumber:
+		return "number"
+	case protocol.KindUUID, protocol.KindStr, protocol.KindTail, protocol.KindString:
+		return "string"
+	case protocol.KindBoolean:
+		return "boolean"
+	case protocol.KindList:
+		return f.tsObject(fld.Fields) + "[]"
+	case protocol.KindObject:
+		return f.tsObject(fld.Fields)
+	case protocol.KindJSON, protocol.KindArray, protocol.KindRecord:
+		if fld.Elem == nil {
+			f.fail("field %q does not describe its elements", fld.Name)
+			return "unknown"
+		}
+		elem := f.tsType(*fld.Elem)
+		switch fld.Kind {
+		case protocol.KindArray:
+			return elem + "[]"
+		case protocol.KindRecord:
+			return "Record<string, " + elem + ">"
+		}
+		return elem
+	}
+
+	f.fail("field %q has unknown kind %q", fld.Name, fld.Kind)
+	return "unknown"
+}
+
+func (f *tsFile) tsObject(fields []protocol.Field) string {
+	props := make([]string, len(fields))
+	for i, fld := range fields {
+		props[i] = fld.Name + ": " + f.tsType(fld)
+	}
+	return "{ " + strings.Join(props, "; ") + " }"
+}
+
+func (f *tsFile) decodeExpr(fld protocol.Field) string {
+	switch fld.Kind {
+	case protocol.KindStr:
+		f.usesVersion = f.usesVersion || f.strVersion != ""
+		return "r.str(" + f.strVersion + ")"
+	case protocol.KindU8, protocol.KindU16, protocol.KindU32, protocol.KindU64, protocol.KindUUID, protocol.KindTail:
+		return "r." + string(fld.Kind) + "()"
+	case protocol.KindBoolean:
+		return "r.bool()"
+	case protocol.KindArray:
+		if fld.Elem == nil {
+			f.fail("field %q does not describe its elements", fld.Name)
+			return "undefined"
+		}
+		return fmt.Sprintf("r.array(%d, () => %s)", fld.Count, f.decodeExpr(*fld.Elem))
+	case protocol.KindList:
+		props := make([]string, len(fld.Fields))
+		for i, item := range fld.Fields {
+			props[i] = item.Name + ": " + f.decodeExpr(item)
+		}
+		return "r.list(() => ({ " + strings.Join(props, ", ") + " }))"
+	case protocol.KindJSON:
+		return "r.json<" + f.tsType(fld) + ">()"
+	}
+
+	f.fail("field %q has kind %q, which is not allowed in binary messages", fld.Name, fld.Kind)
+	return "undefined"
+}
+
+// encodeStmts generates statements encoding the field, where value is an expression for
+// the field's value.
+func (f *tsFile) encodeStmts(indent int, fld protocol.Field, value string) {
+	switch fld.Kind {
+	case protocol.KindStr:
+		if f.strVersion != "" {
+			f.usesVersion = true
+			f.line(indent, "w.str(%s, %s);", value, f.strVersion)
+		} else {
+			f.line(indent, "w.str(%s);", value)
+		}
+	case protocol.KindU8, protocol.KindU16, protocol.KindU32, protocol.KindU64, protocol.KindUUID, protocol.KindTail, protocol.KindJSON:
+		f.line(indent, "w.%s(%s);", fld.Kind, value)
+	case protocol.KindBoolean:
+		f.line(indent, "w.bool(%s);", value)
+	case protocol.KindArray:
+		if fld.Elem == nil {
+			f.fail("field %q does not describe its elements", fld.Name)
+			return
+		}
+		f.line(indent, "w.count(%s, %d);", value, fld.Count)
+		f.line(indent, "for (const elem of %s) {", value)
+		f.encodeStmts(indent+1, *fld.Elem, "elem")
+		f.line(indent, "}")
+	case protocol.KindList:
+		f.line(indent, "for (const item of %s) {", value)
+		for _, itemFld := range fld.Fields {
+			f.encodeStmts(indent+1, itemFld, "item."+itemFld.Name)
+		}
+		f.line(indent, "}")
+	default:
+		f.fail("field %q has kind %q, which is not allowed in binary messages", fld.Name, fld.Kind)
+	}
+}
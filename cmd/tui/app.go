@@ -0,0 +1,262 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/client"
+	"github.com/samclaus/games/client/bravewength"
+	"github.com/samclaus/games/client/skull"
+	"github.com/samclaus/games/protocol"
+)
+
+// maxChatLines is how many chat lines are remembered; only the last few get drawn.
+const maxChatLines = 200
+
+// chatLine is a chat message, as much of it as gets drawn.
+type chatLine struct {
+	channel string
+	id      uint64
+	sent    time.Time
+	kind    byte
+	src     uuid.UUID
+	content string
+
+	// reactions are the members who reacted to the message with each emoji
+	reactions map[string][]uuid.UUID
+}
+
+// app is everything the client knows about the room, plus the input line.
+type app struct {
+	cli *client.Client
+
+	roomID   uint32
+	roomName string
+	members  map[uuid.UUID]string
+	host     uuid.UUID
+	mods     map[uuid.UUID]bool
+	chat     []chatLine
+	channels []protocol.Channel // defined by the current game
+	game     string
+
+	paused     bool
+	pausedBy   uuid.UUID
+	pauseVotes []uuid.UUID
+	undoVotes  []uuid.UUID
+
+	board *bravewength.Board
+	roles bravewength.Roles
+	skull *skull.State
+
+	input  []rune
+	status string // result of the last command, shown above the input line
+}
+
+func newApp(cli *client.Client) *app {
+	return &app{
+		cli:     cli,
+		members: make(map[uuid.UUID]string),
+		status:  "Type /help for commands.",
+	}
+}
+
+// handle updates the app with an event from the server.
+func (a *app) handle(ev client.Event) {
+	switch ev := ev.(type) {
+	case client.Init:
+		a.roomID = ev.RoomID
+		a.roomName = ev.RoomName
+		a.setGame(ev.GameID)
+
+	case client.MembersSet:
+		for _, m := range ev.Members {
+			a.members[m.ID] = m.Name
+		}
+
+	case client.MembersDeleted:
+		for _, id := range ev.IDs {
+			delete(a.members, id)
+		}
+
+	case client.ModeratorsSet:
+		a.host = ev.Host
+		a.mods = make(map[uuid.UUID]bool, len(ev.Moderators))
+		for _, id := range ev.Moderators {
+			a.mods[id] = true
+		}
+
+	case client.ChatHistory:
+		// Histories of different channels can arrive in any order, so replace the
+		// channel's lines and put everything back in order
+		kept := a.chat[:0]
+		for _, line := range a.chat {
+			if line.channel != ev.Channel {
+				kept = append(kept, line)
+			}
+		}
+		a.chat = kept
+		for _, m := range ev.Messages {
+			a.addChat(client.ChatMessage{Channel: ev.Channel, ChatMessage: m})
+		}
+		sort.SliceStable(a.chat, func(i, j int) bool {
+			return a.chat[i].sent.Before(a.chat[j].sent)
+		})
+
+	case client.ChatMessage:
+		a.addChat(ev)
+
+	case client.ChatReactions:
+		for _, r := range ev.Reactions {
+			if line := a.chatLine(ev.Channel, r.ID); line != nil {
+				if line.reactions == nil {
+					line.reactions = make(map[string][]uuid.UUID)
+				}
+				line.reactions[r.Emoji] = append(line.reactions[r.Emoji], r.Member)
+			}
+		}
+
+	case client.ReactionSet:
+		if line := a.chatLine(ev.Channel, ev.ID); line != nil {
+			if len(ev.Members) == 0 {
+				delete(line.reactions, ev.Emoji)
+			} else {
+				if line.reactions == nil {
+					line.reactions = make(map[string][]uuid.UUID)
+				}
+				line.reactions[ev.Emoji] = ev.Members
+			}
+		}
+
+	case client.ChatMessageDeleted:
+		if line := a.chatLine(ev.Channel, ev.ID); line != nil {
+			line.kind, line.content, line.reactions = protocol.ChatDeleted, "", nil
+		}
+
+	case client.ChannelsSet:
+		a.channels = ev.Channels
+
+	case client.GameSet:
+		a.setGame(ev.GameID)
+
+	case client.PauseSet:
+		a.paused, a.pausedBy, a.pauseVotes = ev.Paused, ev.By, ev.Votes
+
+	case client.UndoVotesSet:
+		a.undoVotes = ev.Votes
+
+	case client.GameCrashed:
+		a.status = "Error: " + ev.GameID + " crashed"
+
+	case client.GameMessage:
+		switch st := ev.State.(type) {
+		case *bravewength.Board:
+			a.board = st
+		case bravewength.Roles:
+			a.roles = st
+		case *skull.State:
+			a.skull = st
+		}
+	}
+}
+
+func (a *app) setGame(id string) {
+	a.game = id
+	a.paused, a.pausedBy, a.pauseVotes = false, uuid.Nil, nil
+	a.undoVotes = nil
+	a.board, a.roles, a.skull = nil, nil, nil
+	a.channels = nil
+}
+
+func (a *app) addChat(m client.ChatMessage) {
+	if len(a.chat) == maxChatLines {
+		copy(a.chat, a.chat[1:])
+		a.chat = a.chat[:maxChatLines-1]
+	}
+	a.chat = append(a.chat, chatLine{m.Channel, m.ID, m.Sent(), m.Kind, m.Src, m.Content, nil})
+}
+
+// chatLine returns the line for a message, or nil if it is not one of the remembered
+// lines.
+func (a *app) chatLine(channel string, id uint64) *chatLine {
+	for i := range a.chat {
+		if line := &a.chat[i]; line.channel == channel && line.id == id {
+			return line
+		}
+	}
+	return nil
+}
+
+// key handles a key press, returning true if the player wants to quit.
+func (a *app) key(k rune) bool {
+	switch k {
+	case keyEnter, keyNewline:
+		line := string(a.input)
+		a.input = a.input[:0]
+		return a.submit(line)
+
+	case keyBackspace, keyCtrlH:
+		if len(a.input) > 0 {
+			a.input = a.input[:len(a.input)-1]
+		}
+
+	case keyCtrlU:
+		a.input = a.input[:0]
+
+	default:
+		if k != utf8.RuneError && unicode.IsPrint(k) {
+			a.input = append(a.input, k)
+		}
+	}
+
+	return false
+}
+
+// name returns the name of a member, or a short form of their ID if they are no longer
+// in the room.
+func (a *app) name(id uuid.UUID) string {
+	if name, ok := a.members[id]; ok {
+		return name
+	}
+	return id.String()[:8]
+}
+
+// memberNamed returns the ID of the member with the given name, ignoring case.
+func (a *app) memberNamed(name string) (uuid.UUID, bool) {
+	for id, n := range a.members {
+		if strings.EqualFold(n, name) {
+			return id, true
+		}
+	}
+	return uuid.Nil, false
+}
+
+// channelLabel returns how a chat channel is shown before its messages, or "" for the
+// global channel.
+func (a *app) channelLabel(channel string) string {
+	if channel == protocol.GlobalChannel {
+		return ""
+	}
+	if x, y, ok := protocol.ParseDirectChannel(channel); ok {
+		if x == a.cli.ID() {
+			x = y
+		}
+		return "[dm " + a.name(x) + "] "
+	}
+	return "[" + channel + "] "
+}
+
+// sortedMembers returns the IDs of every member, sorted by name.
+func (a *app) sortedMembers() []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(a.members))
+	for id := range a.members {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return a.members[ids[i]] < a.members[ids[j]]
+	})
+	return ids
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/client/bravewength"
+	"github.com/samclaus/games/client/skull"
+)
+
+// command is a slash command. Its run function returns a request for the current game,
+// if it has one to send, or an error to show the player.
+type command struct {
+	args string // usage, for /help
+	help string
+	game string // game the command is for, or empty for room commands
+	run  func(a *app, args []string) ([]byte, error)
+}
+
+var gameNames = map[string]string{
+	"bravewength": bravewength.GameID,
+	"skull":       skull.GameID,
+}
+
+var roleNames = map[string]bravewength.Role{
+	"spectator":     bravewength.Spectator,
+	"teal-knower":   bravewength.TealKnower,
+	"teal-seeker":   bravewength.TealSeeker,
+	"purple-knower": bravewength.PurpleKnower,
+	"purple-seeker": bravewength.PurpleSeeker,
+}
+
+// commands is set by init because /help needs to refer to it.
+var commands map[string]command
+
+// commandOrder is the order commands are listed by /help.
+var commandOrder = []string{
+	"help", "commands", "quit", "boot", "kill", "pause", "resume", "undo",
+	"say", "dm", "react", "mod", "unmod", "mute", "unmute",
+	"role", "clue", "reveal", "endturn", "newgame", "endgame",
+	"join", "leave", "restart", "abort", "play", "bid", "pass", "pick", "move", "shuffled", "take",
+}
+
+func init() {
+	commands = map[string]command{
+		"help": {"", "list the commands for the current game", "", func(a *app, _ []string) ([]byte, error) {
+			var sb strings.Builder
+			for _, name := range commandOrder {
+				cmd := commands[name]
+				if cmd.game == "" || cmd.game == a.game {
+					fmt.Fprintf(&sb, "/%s %s: %s\n", name, cmd.args, cmd.help)
+				}
+			}
+			sb.WriteString("Anything else goes to the room, e.g., /roll 2d6; try /commands")
+			a.status = sb.String()
+			return nil, nil
+		}},
+		"quit": {"", "leave the room", "", nil}, // handled by submit
+		"commands": {"", "list the room's commands, in chat", "", func(a *app, _ []string) ([]byte, error) {
+			return nil, a.cli.Chat("/help")
+		}},
+		"boot": {"bravewength|skull", "boot a game", "", func(a *app, args []string) ([]byte, error) {
+			if len(args) != 1 || gameNames[args[0]] == "" {
+				return nil, fmt.Errorf("which game? bravewength or skull")
+			}
+			return nil, a.cli.BootGame(gameNames[args[0]])
+		}},
+		"kill": {"", "kill the current game", "", func(a *app, _ []string) ([]byte, error) {
+			return nil, a.cli.KillGame()
+		}},
+		"pause": {"", "pause the current game (or vote to, if you aren't the host)", "", func(a *app, _ []string) ([]byte, error) {
+			return nil, a.cli.PauseGame()
+		}},
+		"resume": {"", "resume the current game (or vote to, if you aren't the host)", "", func(a *app, _ []string) ([]byte, error) {
+			return nil, a.cli.ResumeGame()
+		}},
+		"undo": {"", "undo the last move (or vote to, if you aren't the host)", "", func(a *app, _ []string) ([]byte, error) {
+			return nil, a.cli.Undo()
+		}},
+		"say": {"<channel> <message>", "post to one of the game's chat channels", "", func(a *app, args []string) ([]byte, error) {
+			if len(args) < 2 {
+				return nil, fmt.Errorf("which channel, and what message?")
+			}
+			return nil, a.cli.ChatIn(args[0], strings.Join(args[1:], " "))
+		}},
+		"mod": {"<name>", "make a member a moderator, as the host", "", func(a *app, args []string) ([]byte, error) {
+			id, err := a.oneMember(args)
+			if err != nil {
+				return nil, err
+			}
+			return nil, a.cli.SetModerator(id, true)
+		}},
+		"unmod": {"<name>", "take away a member's moderator status, as the host", "", func(a *app, args []string) ([]byte, error) {
+			id, err := a.oneMember(args)
+			if err != nil {
+				return nil, err
+			}
+			return nil, a.cli.SetModerator(id, false)
+		}},
+		"mute": {"<name> <minutes>", "stop a member from chatting, as a moderator", "", func(a *app, args []string) ([]byte, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("who, and for how many minutes?")
+			}
+			id, err := a.oneMember(args[:1])
+			if err != nil {
+				return nil, err
+			}
+			minutes, err := parseNumber(args[1:], 1, 24*60)
+			if err != nil {
+				return nil, err
+			}
+			return nil, a.cli.Mute(id, time.Duration(minutes)*time.Minute)
+		}},
+		"unmute": {"<name>", "let a muted member chat again, as a moderator", "", func(a *app, args []string) ([]byte, error) {
+			id, err := a.oneMember(args)
+			if err != nil {
+				return nil, err
+			}
+			return nil, a.cli.Mute(id, 0)
+		}},
+		"react": {"<emoji> [lines back]", "react to the newest chat line, or an older one, or take it back", "", func(a *app, args []string) ([]byte, error) {
+			if len(args) < 1 || len(args) > 2 {
+				return nil, fmt.Errorf("react with what?")
+			}
+			back := 1
+			if len(args) == 2 {
+				var err error
+				if back, err = parseNumber(args[1:], 1, chatHeight); err != nil {
+					return nil, err
+				}
+			}
+			if back > len(a.chat) {
+				return nil, fmt.Errorf("not that many chat lines")
+			}
+			line := a.chat[len(a.chat)-back]
+			return nil, a.cli.React(line.channel, line.id, args[0])
+		}},
+		"dm": {"<name> <message>", "message another member directly", "", func(a *app, args []string) ([]byte, error) {
+			if len(args) < 2 {
+				return nil, fmt.Errorf("who to, and what message?")
+			}
+			to, err := a.oneMember(args[:1])
+			if err != nil {
+				return nil, err
+			}
+			return nil, a.cli.DirectMessage(to, strings.Join(args[1:], " "))
+		}},
+
+		"role": {"teal-knower|teal-seeker|purple-knower|purple-seeker|spectator", "change roles", bravewength.GameID, func(a *app, args []string) ([]byte, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("which role?")
+			}
+			role, ok := roleNames[args[0]]
+			if !ok {
+				return nil, fmt.Errorf("unknown role %q", args[0])
+			}
+			return bravewength.SetRole(role), nil
+		}},
+		"clue": {"<clue> <count>", "give a clue, as a knower", bravewength.GameID, func(a *app, args []string) ([]byte, error) {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("what clue?")
+			}
+			return bravewength.GiveClue(strings.Join(args, " ")), nil
+		}},
+		"reveal": {"<word or number>", "reveal a card, as a seeker", bravewength.GameID, func(a *app, args []string) ([]byte, error) {
+			if len(args) != 1 || a.board == nil {
+				return nil, fmt.Errorf("which card?")
+			}
+			if n, err := strconv.Atoi(args[0]); err == nil && n >= 1 && n <= bravewength.BoardSize {
+				return bravewength.RevealCard(n - 1), nil
+			}
+			for i, word := range a.board.Words {
+				if strings.EqualFold(word, args[0]) {
+					return bravewength.RevealCard(i), nil
+				}
+			}
+			return nil, fmt.Errorf("no card %q on the board", args[0])
+		}},
+		"endturn": {"", "end the turn, as a seeker", bravewength.GameID, func(a *app, _ []string) ([]byte, error) {
+			return bravewength.EndTurn(), nil
+		}},
+		"newgame": {"", "deal a new board", bravewength.GameID, func(a *app, _ []string) ([]byte, error) {
+			return bravewength.NewGame(), nil
+		}},
+		"endgame": {"", "end the game without a winner", bravewength.GameID, func(a *app, _ []string) ([]byte, error) {
+			return bravewength.EndGame(), nil
+		}},
+
+		"join": {"<seat 1-6>", "take a seat", skull.GameID, oneNumber(1, skull.MaxPlayers, skull.JoinGame)},
+		"leave": {"", "give up your seat", skull.GameID, func(a *app, _ []string) ([]byte, error) {
+			return skull.LeaveGame(), nil
+		}},
+		"restart": {"", "start a game with everyone seated", skull.GameID, func(a *app, _ []string) ([]byte, error) {
+			return skull.RestartGame(), nil
+		}},
+		"abort": {"", "end the game without a winner", skull.GameID, func(a *app, _ []string) ([]byte, error) {
+			return skull.AbortGame(), nil
+		}},
+		"play": {"<card>", "play a card from your hand", skull.GameID, oneNumber(1, 4, skull.Play)},
+		"bid": {"<cards>", "raise the bid", skull.GameID, func(a *app, args []string) ([]byte, error) {
+			n, err := parseNumber(args, 1, 255)
+			if err != nil {
+				return nil, err
+			}
+			return skull.Bid(n), nil
+		}},
+		"pass": {"", "pass on the bid", skull.GameID, func(a *app, _ []string) ([]byte, error) {
+			return skull.Pass(), nil
+		}},
+		"pick": {"<seat>", "flip the top card of a seat's stack", skull.GameID, oneNumber(1, skull.MaxPlayers, skull.Pick)},
+		"move": {"<from> <to>", "swap two cards in your hand", skull.GameID, func(a *app, args []string) ([]byte, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("which two cards?")
+			}
+			from, err := parseNumber(args[:1], 1, 4)
+			if err != nil {
+				return nil, err
+			}
+			to, err := parseNumber(args[1:], 1, 4)
+			if err != nil {
+				return nil, err
+			}
+			return skull.MoveCard(from-1, to-1), nil
+		}},
+		"shuffled": {"", "let the skull's owner take a card", skull.GameID, func(a *app, _ []string) ([]byte, error) {
+			return skull.DoneShuffling(), nil
+		}},
+		"take": {"<card>", "take a card from the bidder", skull.GameID, oneNumber(1, 4, skull.TakeCard)},
+	}
+}
+
+// oneMember parses a single member name.
+func (a *app) oneMember(args []string) (uuid.UUID, error) {
+	if len(args) != 1 {
+		return uuid.Nil, fmt.Errorf("which member?")
+	}
+	id, ok := a.memberNamed(args[0])
+	if !ok {
+		return uuid.Nil, fmt.Errorf("nobody named %q", args[0])
+	}
+	return id, nil
+}
+
+// oneNumber returns a command function for requests with a single 1-based index.
+func oneNumber(lo, hi int, req func(int) []byte) func(*app, []string) ([]byte, error) {
+	return func(_ *app, args []string) ([]byte, error) {
+		n, err := parseNumber(args, lo, hi)
+		if err != nil {
+			return nil, err
+		}
+		return req(n - 1), nil
+	}
+}
+
+func parseNumber(args []string, lo, hi int) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected a number from %d to %d", lo, hi)
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("expected a number from %d to %d", lo, hi)
+	}
+	return n, nil
+}
+
+// submit handles a line of input, returning true if the player wants to quit.
+func (a *app) submit(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false
+	}
+
+	if !strings.HasPrefix(line, "/") {
+		a.report(a.cli.Chat(line))
+		return false
+	}
+
+	fields := strings.Fields(line[1:])
+	if len(fields) == 0 {
+		return false
+	}
+	if fields[0] == "quit" {
+		return true
+	}
+
+	cmd, ok := commands[fields[0]]
+	if !ok || (cmd.game != "" && cmd.game != a.game) {
+		// Might be one of the room's commands, like /roll, which it answers in chat
+		a.report(a.cli.Chat(line))
+		return false
+	}
+
+	a.status = ""
+	req, err := cmd.run(a, fields[1:])
+	if err == nil && req != nil {
+		err = a.cli.SendGame(req)
+	}
+	a.report(err)
+	return false
+}
+
+func (a *app) report(err error) {
+	if err != nil {
+		a.status = "Error: " + err.Error()
+	}
+}
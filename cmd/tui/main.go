@@ -0,0 +1,120 @@
+// Command tui is a terminal client for games servers. It joins (or creates) a room,
+// shows its members and chat, and has playable views for Bravewength and Skull. It only
+// talks to the server over the WebSocket protocol, using the client package, so it
+// works against any server and doubles as a way to poke at the protocol by hand:
+//
+//	go run ./cmd/tui -name alice -room new -room-name "Game night"
+//	go run ./cmd/tui -name bob -room 0
+//
+// Anything typed is sent to the chat, except for commands starting with a slash; type
+// /help to see them. It needs a Unix-like terminal with the stty command.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/client"
+	"github.com/samclaus/games/client/bravewength"
+	"github.com/samclaus/games/client/skull"
+)
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/join", "address of the server's join endpoint")
+	room := flag.String("room", "new", `ID of the room to join, or "new" to create one`)
+	roomName := flag.String("room-name", "", "name of the room to create")
+	name := flag.String("name", "", "player name")
+	id := flag.String("id", "", "client ID to rejoin as (default random)")
+	flag.Parse()
+
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "-name is required")
+		os.Exit(2)
+	}
+	if *room == "new" && *roomName == "" {
+		*roomName = *name + "'s room"
+	}
+
+	var clientID uuid.UUID
+	if *id != "" {
+		var err error
+		if clientID, err = uuid.Parse(*id); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid -id:", err)
+			os.Exit(2)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	cli, err := client.Dial(ctx, client.Config{
+		URL:      *url,
+		Room:     *room,
+		RoomName: *roomName,
+		Name:     *name,
+		ClientID: clientID,
+		Games:    []client.GameDecoder{bravewength.Decoder(), skull.Decoder()},
+	})
+	cancel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	restore, err := rawMode()
+	if err != nil {
+		cli.Close()
+		fmt.Fprintln(os.Stderr, "could not set up the terminal:", err)
+		os.Exit(1)
+	}
+
+	err = run(cli)
+	restore()
+	fmt.Print(reset, "\n")
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Disconnected:", err)
+		os.Exit(1)
+	}
+}
+
+// run draws the room and handles input until the player quits or the connection closes.
+func run(cli *client.Client) error {
+	a := newApp(cli)
+	keys := make(chan rune)
+	signals := make(chan os.Signal, 1)
+
+	go readKeys(keys)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	for {
+		a.draw(os.Stdout)
+
+		select {
+		case ev, ok := <-cli.Events():
+			if !ok {
+				return cli.Err()
+			}
+			a.handle(ev)
+
+		case k, ok := <-keys:
+			if !ok || a.key(k) {
+				cli.Close()
+				for range cli.Events() {
+				}
+				return nil
+			}
+
+		case <-signals:
+			cli.Close()
+			for range cli.Events() {
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ANSI escape sequences used for drawing.
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	reset       = "\x1b[0m"
+	bold        = "\x1b[1m"
+	dim         = "\x1b[2m"
+	underline   = "\x1b[4m"
+)
+
+// stty runs the stty command on the terminal, returning its output.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// rawMode turns off line buffering and echoing, so that every key gets read as soon as
+// it is pressed and the input line can be drawn along with everything else. It returns
+// a function which puts the terminal back how it was.
+func rawMode() (restore func(), err error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return nil, err
+	}
+	return func() { stty(saved) }, nil
+}
+
+// Keys which get special treatment by the input line.
+const (
+	keyEnter     = '\r'
+	keyNewline   = '\n'
+	keyBackspace = 0x7f
+	keyCtrlH     = 0x08
+	keyCtrlU     = 0x15
+	keyEscape    = 0x1b
+)
+
+// readKeys sends every rune typed on the terminal to the keys channel, until stdin is
+// closed.
+func readKeys(keys chan<- rune) {
+	defer close(keys)
+
+	r := bufio.NewReader(os.Stdin)
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			return
+		}
+
+		// Throw away escape sequences (arrow keys and the like), which all end with a
+		// letter (other than the O of SS3 sequences) or a tilde
+		if c == keyEscape {
+			for {
+				c, _, err = r.ReadRune()
+				if err != nil {
+					return
+				}
+				if c == '~' || (c >= 'A' && c <= 'Z' && c != 'O') || (c >= 'a' && c <= 'z') {
+					break
+				}
+			}
+			continue
+		}
+
+		keys <- c
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/samclaus/games/client/bravewength"
+	"github.com/samclaus/games/client/skull"
+	"github.com/samclaus/games/protocol"
+)
+
+// chatHeight is how many chat lines are drawn.
+const chatHeight = 10
+
+// draw redraws the whole screen.
+func (a *app) draw(w io.Writer) {
+	var sb strings.Builder
+
+	sb.WriteString(clearScreen)
+	fmt.Fprintf(&sb, "%sRoom %d: %s%s\n", bold, a.roomID, a.roomName, reset)
+
+	names := make([]string, 0, len(a.members))
+	for _, id := range a.sortedMembers() {
+		name := a.members[id]
+		switch {
+		case id == a.host:
+			name += " (host)"
+		case a.mods[id]:
+			name += " (mod)"
+		}
+		if id == a.cli.ID() {
+			names = append(names, bold+name+" (you)"+reset)
+		} else {
+			names = append(names, name)
+		}
+	}
+	fmt.Fprintf(&sb, "Members: %s\n", strings.Join(names, ", "))
+
+	switch a.game {
+	case "":
+		fmt.Fprintf(&sb, "Game: none %s(/boot bravewength or /boot skull)%s\n", dim, reset)
+	case bravewength.GameID:
+		sb.WriteString("Game: Bravewength" + a.gameNote() + "\n\n")
+		a.drawBravewength(&sb)
+	case skull.GameID:
+		sb.WriteString("Game: Skull" + a.gameNote() + "\n\n")
+		a.drawSkull(&sb)
+	default:
+		fmt.Fprintf(&sb, "Game: %s%s %s(no view for this game)%s\n", a.game, a.gameNote(), dim, reset)
+	}
+
+	sb.WriteString("\n" + bold + "Chat" + reset)
+	if len(a.channels) > 0 {
+		names := make([]string, len(a.channels))
+		for i, ch := range a.channels {
+			names[i] = ch.ID
+			if !ch.CanPost {
+				names[i] += " (read only)"
+			}
+		}
+		fmt.Fprintf(&sb, " %s(channels: %s; /say <channel> to post)%s", dim, strings.Join(names, ", "), reset)
+	}
+	sb.WriteString("\n")
+	chat := a.chat
+	if len(chat) > chatHeight {
+		chat = chat[len(chat)-chatHeight:]
+	}
+	for _, line := range chat {
+		stamp := line.sent.Local().Format("15:04")
+		switch line.kind {
+		case protocol.ChatPlayer:
+			fmt.Fprintf(&sb, "%s%s%s %s%s%s:%s %s%s\n", dim, stamp, reset, a.channelLabel(line.channel), bold, a.name(line.src), reset, line.content, reactionSummary(line))
+		case protocol.ChatDeleted:
+			fmt.Fprintf(&sb, "%s%s %s%s: (deleted)%s\n", dim, stamp, a.channelLabel(line.channel), a.name(line.src), reset)
+		default:
+			fmt.Fprintf(&sb, "%s%s %s%s%s\n", dim, stamp, line.content, reset, reactionSummary(line))
+		}
+	}
+
+	if a.status != "" {
+		fmt.Fprintf(&sb, "\n%s%s%s\n", dim, a.status, reset)
+	}
+	fmt.Fprintf(&sb, "\n> %s", string(a.input))
+
+	io.WriteString(w, sb.String())
+}
+
+// reactionSummary describes the reactions to a chat line, like "  👍 2  😂 1", or
+// returns an empty string if there are none.
+func reactionSummary(line chatLine) string {
+	emoji := make([]string, 0, len(line.reactions))
+	for e := range line.reactions {
+		emoji = append(emoji, e)
+	}
+	sort.Strings(emoji)
+
+	var sb strings.Builder
+	for _, e := range emoji {
+		fmt.Fprintf(&sb, "  %s %d", e, len(line.reactions[e]))
+	}
+	return sb.String()
+}
+
+// Colors of each card type: the background of a revealed card, and the text of a card
+// which is only known to knowers.
+var (
+	cardBackground = [...]string{
+		bravewength.CardNeutral: "\x1b[30;47m",
+		bravewength.CardTeal:    "\x1b[30;46m",
+		bravewength.CardPurple:  "\x1b[97;45m",
+		bravewength.CardBlack:   "\x1b[97;40m",
+	}
+	cardForeground = [...]string{
+		bravewength.CardNeutral: "\x1b[37m",
+		bravewength.CardTeal:    "\x1b[1;36m",
+		bravewength.CardPurple:  "\x1b[1;35m",
+		bravewength.CardBlack:   "\x1b[1;90m",
+	}
+)
+
+var bravewengthRoleNames = [...]string{
+	bravewength.Spectator:    "spectator",
+	bravewength.PurpleSeeker: "purple seeker",
+	bravewength.PurpleKnower: "purple knower",
+	bravewength.TealSeeker:   "teal seeker",
+	bravewength.TealKnower:   "teal knower",
+}
+
+var teamNames = [...]string{
+	bravewength.TeamNone:   "nobody",
+	bravewength.TeamTeal:   "teal",
+	bravewength.TeamPurple: "purple",
+}
+
+func roleName(r bravewength.Role) string {
+	if int(r) < len(bravewengthRoleNames) {
+		return bravewengthRoleNames[r]
+	}
+	return "unknown role"
+}
+
+func teamName(t bravewength.Team) string {
+	if int(t) < len(teamNames) {
+		return teamNames[t]
+	}
+	return "unknown team"
+}
+
+// cellWidth is the width of a card on the board, including the space between cards.
+const cellWidth = 16
+
+// gameNote says whether the game is paused, and how many members voted to pause it (or
+// resume it) or to undo the last move, to go after the name of the game.
+func (a *app) gameNote() string {
+	note := ""
+	switch {
+	case a.paused && len(a.pauseVotes) > 0:
+		note = fmt.Sprintf(" %s(paused by %s, %d voted to resume)%s", bold, a.name(a.pausedBy), len(a.pauseVotes), reset)
+	case a.paused:
+		note = fmt.Sprintf(" %s(paused by %s)%s", bold, a.name(a.pausedBy), reset)
+	case len(a.pauseVotes) > 0:
+		note = fmt.Sprintf(" %s(%d voted to pause)%s", dim, len(a.pauseVotes), reset)
+	}
+	if len(a.undoVotes) > 0 {
+		note += fmt.Sprintf(" %s(%d voted to undo)%s", dim, len(a.undoVotes), reset)
+	}
+	return note
+}
+
+func (a *app) drawBravewength(sb *strings.Builder) {
+	b := a.board
+	if b == nil {
+		return
+	}
+	me := a.roles[a.cli.ID()]
+
+	switch {
+	case b.Ended:
+		fmt.Fprintf(sb, "Game over, %s won. %s(/newgame to play again)%s\n", teamName(b.Winner), dim, reset)
+	case b.Turn.IsSeeker():
+		fmt.Fprintf(sb, "Turn: %s, clue %s%q%s\n", roleName(b.Turn), bold, b.Clue, reset)
+	default:
+		fmt.Fprintf(sb, "Turn: %s\n", roleName(b.Turn))
+	}
+	fmt.Fprintf(sb, "You are a %s %s(/role to change)%s\n\n", roleName(me), dim, reset)
+
+	for i, word := range b.Words {
+		label := fmt.Sprintf("%2d %s", i+1, word)
+		if n := utf8.RuneCountInString(label); n > cellWidth-2 {
+			label = string([]rune(label)[:cellWidth-2])
+		}
+		label = fmt.Sprintf(" %-*s", cellWidth-2, label)
+
+		switch disc, full := b.Discovered[i], b.Layout[i]; {
+		case disc < bravewength.CardHidden:
+			sb.WriteString(cardBackground[disc] + label + reset)
+		case full < bravewength.CardHidden:
+			sb.WriteString(underline + cardForeground[full] + label + reset)
+		default:
+			sb.WriteString(label)
+		}
+		sb.WriteByte(' ')
+
+		if i%5 == 4 {
+			sb.WriteString("\n")
+		}
+	}
+
+	// Who is on which team
+	sb.WriteByte('\n')
+	for _, role := range [...]bravewength.Role{
+		bravewength.TealKnower,
+		bravewength.TealSeeker,
+		bravewength.PurpleKnower,
+		bravewength.PurpleSeeker,
+	} {
+		var players []string
+		for _, id := range a.sortedMembers() {
+			if a.roles[id] == role {
+				players = append(players, a.members[id])
+			}
+		}
+		fmt.Fprintf(sb, "%-14s %s\n", roleName(role)+":", strings.Join(players, ", "))
+	}
+
+	// The last few things that happened
+	log := b.Log
+	if len(log) > 4 {
+		log = log[len(log)-4:]
+	}
+	for _, e := range log {
+		sb.WriteString(dim)
+		switch e.Kind {
+		case bravewength.EventGameStarted:
+			fmt.Fprintf(sb, "%s started a new game", a.name(e.Src))
+		case bravewength.EventGameEnded:
+			fmt.Fprintf(sb, "The game ended")
+		case bravewength.EventClueGiven:
+			fmt.Fprintf(sb, "%s gave the clue %q", a.name(e.Src), e.Clue)
+		case bravewength.EventCardRevealed:
+			fmt.Fprintf(sb, "%s revealed %s", a.name(e.Src), e.Word)
+		case bravewength.EventTurnEnded:
+			fmt.Fprintf(sb, "%s ended their turn", a.name(e.Src))
+		}
+		sb.WriteString(reset + "\n")
+	}
+}
+
+var phaseNames = [...]string{
+	skull.PhaseNoGame:        "waiting for players to sit down (/join, then /restart)",
+	skull.PhaseWinner:        "game over (/restart to play again)",
+	skull.PhaseAborted:       "game aborted (/restart to play again)",
+	skull.PhasePlay:          "playing cards (/play or /bid)",
+	skull.PhaseBid:           "bidding (/bid or /pass)",
+	skull.PhasePick:          "bidder is flipping cards (/pick)",
+	skull.PhaseBidderShuffle: "bidder hit a skull and is shuffling (/move, then /shuffled)",
+	skull.PhaseTakeCard:      "skull's owner is taking a card from the bidder (/take)",
+}
+
+func (a *app) drawSkull(sb *strings.Builder) {
+	s := a.skull
+	if s == nil {
+		return
+	}
+
+	if int(s.Phase) < len(phaseNames) {
+		fmt.Fprintf(sb, "Phase: %s\n", phaseNames[s.Phase])
+	}
+	if s.Phase == skull.PhaseWinner {
+		fmt.Fprintf(sb, "%s%s won!%s\n", bold, a.name(s.Winner), reset)
+	}
+	if s.Phase.Active() {
+		fmt.Fprintf(sb, "Cards played: %d   Bid: %d\n", s.Played, s.Bid)
+	}
+
+	fmt.Fprintf(sb, "\n  %-4s %-20s %4s %6s %5s\n", "Seat", "Player", "Held", "Played", "Score")
+	for i, h := range s.Hands {
+		marker := "  "
+		if s.Phase.Active() && int(s.Turn) == i {
+			marker = bold + "> " + reset
+		}
+
+		player := ""
+		switch h.Status {
+		case skull.HandClaimed:
+			player = a.name(h.ID)
+		case skull.HandLeft:
+			player = a.name(h.ID) + " (left)"
+		}
+		if h.Status != skull.HandUnclaimed && h.ID == a.cli.ID() {
+			player = bold + fmt.Sprintf("%-20s", player) + reset
+		} else {
+			player = fmt.Sprintf("%-20s", player)
+		}
+
+		var notes []string
+		if s.Phase >= skull.PhaseBid && int(s.Bidder) == i {
+			notes = append(notes, "bidder")
+		}
+		if s.Phase == skull.PhaseBid && s.Passed&(1<<i) != 0 {
+			notes = append(notes, "passed")
+		}
+		if s.Phase >= skull.PhaseBidderShuffle && int(s.Taker) == i {
+			notes = append(notes, "skull owner")
+		}
+
+		fmt.Fprintf(sb, "%s%-4d %s %4d %6d %5d  %s\n", marker, i+1, player, h.Held, h.Played, h.Score, strings.Join(notes, ", "))
+	}
+}
@@ -0,0 +1,65 @@
+package games
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// CompressionConfig controls per-message compression (the permessage-deflate WebSocket
+// extension). Compression is negotiated with each client when it connects, so clients
+// that don't support it still get uncompressed messages.
+type CompressionConfig struct {
+	// Enabled turns on negotiation of permessage-deflate. Doing so overrides the
+	// EnableCompression field of the server's websocket.Upgrader.
+	Enabled bool
+	// Level, if non-nil, is the compress/flate level to use; see
+	// (*websocket.Conn).SetCompressionLevel. It is a pointer because every int from -2
+	// to 9 is a valid level, including 0 (flate.NoCompression). Defaults to 1 (best
+	// speed) if nil.
+	Level *int
+	// MinSize is the size in bytes below which messages are sent uncompressed because
+	// compressing them would just waste CPU time. Defaults to 256 if zero; a negative
+	// value compresses every message.
+	MinSize int
+}
+
+// countingConn wraps the network connection underneath a WebSocket so we can tell how
+// many bytes a message took up on the wire after compression. The client's read
+// goroutine writes too (pongs and close frames, via WriteControl), so the counter is
+// atomic, and a control frame sent while a message is being written gets counted
+// along with it; they are tiny, so the measurement is still good enough for metrics.
+type countingConn struct {
+	net.Conn
+	written atomic.Int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+// countingResponseWriter hands a countingConn to the websocket.Upgrader when it hijacks
+// the HTTP connection.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	conn *countingConn
+}
+
+func (w *countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+
+	conn, brw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w.conn = &countingConn{Conn: conn}
+	return w.conn, brw, nil
+}
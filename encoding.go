@@ -0,0 +1,103 @@
+package games
+
+import (
+	"errors"
+
+	"github.com/gorilla/websocket"
+	"github.com/samclaus/games/protocol"
+)
+
+// encoding is how messages sent to a particular client are encoded, which is decided by
+// the WebSocket subprotocol the client asked for when connecting.
+type encoding uint8
+
+const (
+	encodingBinary encoding = iota
+	encodingBinaryV2
+	encodingJSON
+	numEncodings
+)
+
+func encodingForSubprotocol(subprotocol string) encoding {
+	switch subprotocol {
+	case protocol.SubprotocolBinaryV2:
+		return encodingBinaryV2
+	case protocol.SubprotocolJSON:
+		return encodingJSON
+	}
+	return encodingBinary
+}
+
+// version is the version of the binary encoding, for binary encodings.
+func (e encoding) version() protocol.Version {
+	if e == encodingBinaryV2 {
+		return protocol.Version2
+	}
+	return protocol.Version1
+}
+
+// frameType is the WebSocket message type used for messages in this encoding.
+func (e encoding) frameType() int {
+	if e == encodingJSON {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+func (e encoding) appendState(dst []byte, m protocol.Message) []byte {
+	if e == encodingJSON {
+		return protocol.AppendJSON(dst, m)
+	}
+	return protocol.AppendBinary(dst, e.version(), m)
+}
+
+// appendGameMessage converts a binary game-scope message, which is how games create
+// all of their messages, to the given encoding. For JSON, the message gets embedded as
+// JSON if the current game knows how to do that, and as base64 otherwise. Games encode
+// their own messages, so they look the same in every version of the binary encoding.
+func (r *room) appendGameMessage(dst []byte, e encoding, msg []byte) []byte {
+	if e != encodingJSON {
+		return append(dst, msg...)
+	}
+
+	body := msg
+	if len(body) > 0 && body[0] == scopeGame {
+		body = body[1:]
+	}
+
+	if r.jsonGame != nil {
+		var data []byte
+		// If the game panics (or already crashed), the message goes out as base64
+		r.callGame("StateJSON", nil, nil, func() { data = r.jsonGame.StateJSON(body) })
+		if data != nil {
+			return protocol.AppendGameDataJSON(dst, data)
+		}
+	}
+
+	return protocol.AppendGamePayloadJSON(dst, body)
+}
+
+// gameRequestFromJSON converts a game-scope request from a client using the JSON
+// encoding into the binary game-scope body the current game expects.
+func (r *room) gameRequestFromJSON(src *Client, jm protocol.JSONMessage) ([]byte, error) {
+	if jm.Data == nil {
+		return jm.Payload, nil
+	}
+	if r.jsonGame == nil {
+		return nil, errors.New("current game does not accept JSON requests")
+	}
+
+	// Stays set if the game panics (or already crashed)
+	body, err := []byte(nil), errGameCrashed
+	r.callGame("RequestFromJSON", src, jm.Data, func() { body, err = r.jsonGame.RequestFromJSON(jm.Data) })
+	return body, err
+}
+
+// kindOf returns the scope and message type header bytes of a binary message, which is
+// how snapshots are matched up with the snapshots they supersede.
+func kindOf(msg []byte) uint16 {
+	if len(msg) < 2 {
+		return 0
+	}
+	return uint16(msg[0])<<8 | uint16(msg[1])
+}
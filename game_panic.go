@@ -0,0 +1,66 @@
+package games
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/protocol"
+)
+
+// This file keeps a buggy game from taking its room (and the rest of the server) down
+// with it. Every call into the current game (including converting its messages to and
+// from JSON) goes through callGame, which recovers if the game panics and has the room
+// shut the game down.
+
+// maxPanicStack is how much of the stack is logged when a game panics, in bytes.
+const maxPanicStack = 16 << 10
+
+var errGameCrashed = errors.New("current game crashed")
+
+// callGame calls fn, which calls one of the current game's hooks, unless the game
+// already crashed during the current event (in which case the game can't be trusted
+// to do anything sensible, so fn is skipped). The hook is named for the log, and src
+// and req are whatever the game was handling, if anything.
+func (r *room) callGame(hook string, src *Client, req []byte, fn func()) {
+	if r.gameAction == gameActionCrash {
+		return
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			r.gameCrashed(hook, src, req, v)
+		}
+	}()
+	fn()
+}
+
+// gameCrashed logs a panic recovered from one of the current game's hooks, and has the
+// room shut the game down once the current event is done being processed.
+func (r *room) gameCrashed(hook string, src *Client, req []byte, v any) {
+	stack := make([]byte, maxPanicStack)
+	stack = stack[:runtime.Stack(stack, false)]
+
+	about := ""
+	if src != nil {
+		about = fmt.Sprintf(" (client ID: %s, name: %q)", src.ID.String(), src.Name)
+	}
+	if req != nil {
+		about += fmt.Sprintf(" (request: %x)", req)
+	}
+	log.Printf("[Room %d] Game %q panicked in %s%s: %v\n%s", r.ID, r.currentGameID, hook, about, v, stack)
+
+	r.metrics.gamePanics.Add(1)
+	r.gameAction = gameActionCrash
+}
+
+// crashGame tells members that the current game crashed, and shuts it down without
+// calling its Deinit.
+func (r *room) crashGame() {
+	id := r.currentGameID
+	r.broadcastState(&protocol.GameCrashedState{GameID: id}, false)
+	r.killGame()
+	r.postNote(protocol.ChatSystem, uuid.Nil, id+" crashed and was shut down")
+}
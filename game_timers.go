@@ -0,0 +1,99 @@
+package games
+
+import "time"
+
+// This file contains the timers games set with Room.After. The room keeps a single
+// time.Timer for whichever game timer fires first, and stops it while the game is
+// paused, keeping track of how much time each game timer had left.
+
+type gameTimer struct {
+	at   time.Time     // when the timer fires, unless the game is paused
+	left time.Duration // how much time was left when the game was paused
+	fn   func(players []*Client)
+}
+
+func (r *room) addTimer(d time.Duration, fn func(players []*Client)) *gameTimer {
+	t := &gameTimer{at: time.Now().Add(d), left: d, fn: fn}
+	r.timers = append(r.timers, t)
+	r.scheduleTimers()
+	return t
+}
+
+func (r *room) cancelTimer(t *gameTimer) {
+	for i, other := range r.timers {
+		if other == t {
+			r.timers = append(r.timers[:i], r.timers[i+1:]...)
+			r.scheduleTimers()
+			return
+		}
+	}
+}
+
+// scheduleTimers replaces the room's time.Timer with one for whichever game timer fires
+// first, or none if there are no game timers or the game is paused.
+func (r *room) scheduleTimers() {
+	// A new time.Timer each time means there is never a stale tick to worry about
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+		r.timerC = nil
+	}
+
+	if r.paused || len(r.timers) == 0 {
+		return
+	}
+
+	next := r.timers[0].at
+	for _, t := range r.timers[1:] {
+		if t.at.Before(next) {
+			next = t.at
+		}
+	}
+
+	r.timer = time.NewTimer(time.Until(next))
+	r.timerC = r.timer.C
+}
+
+// fireTimers calls every game timer whose time has come, removing them first so that
+// they can set new timers.
+func (r *room) fireTimers() {
+	now := time.Now()
+	var due, rest []*gameTimer
+
+	for _, t := range r.timers {
+		if t.at.After(now) {
+			rest = append(rest, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	r.timers = rest
+
+	for _, t := range due {
+		r.callGame("timer", nil, nil, func() { t.fn(r.members) })
+	}
+
+	r.scheduleTimers()
+}
+
+func (r *room) suspendTimers() {
+	now := time.Now()
+	for _, t := range r.timers {
+		t.left = t.at.Sub(now)
+	}
+	r.scheduleTimers()
+}
+
+func (r *room) resumeTimers() {
+	now := time.Now()
+	for _, t := range r.timers {
+		t.at = now.Add(t.left)
+	}
+	r.scheduleTimers()
+}
+
+// dropTimers forgets every game timer, for when the game is killed or the room closes.
+func (r *room) dropTimers() {
+	r.timers = nil
+	r.scheduleTimers()
+}
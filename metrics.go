@@ -0,0 +1,71 @@
+package games
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// Metrics is a snapshot of counters covering the whole life of a server.
+type Metrics struct {
+	Rooms int `json:"rooms"`
+
+	// GamePanics is how many times a game panicked and was shut down
+	GamePanics uint64 `json:"game_panics"`
+
+	// Messages that were sent compressed, their total size before compression, and
+	// their total size on the wire (including WebSocket frame headers)
+	CompressedMessages  uint64 `json:"compressed_messages"`
+	CompressedRawBytes  uint64 `json:"compressed_raw_bytes"`
+	CompressedWireBytes uint64 `json:"compressed_wire_bytes"`
+	// CompressionRatio is CompressedWireBytes / CompressedRawBytes, so smaller is
+	// better; it is zero if nothing has been compressed yet
+	CompressionRatio float64 `json:"compression_ratio"`
+}
+
+// metrics holds the live counters behind Metrics; every field is safe to update from
+// any goroutine.
+type metrics struct {
+	gamePanics          atomic.Uint64
+	compressedMessages  atomic.Uint64
+	compressedRawBytes  atomic.Uint64
+	compressedWireBytes atomic.Uint64
+}
+
+func (m *metrics) recordCompressed(rawBytes, wireBytes int) {
+	m.compressedMessages.Add(1)
+	m.compressedRawBytes.Add(uint64(rawBytes))
+	m.compressedWireBytes.Add(uint64(wireBytes))
+}
+
+func (m *metrics) snapshot() Metrics {
+	snap := Metrics{
+		GamePanics:          m.gamePanics.Load(),
+		CompressedMessages:  m.compressedMessages.Load(),
+		CompressedRawBytes:  m.compressedRawBytes.Load(),
+		CompressedWireBytes: m.compressedWireBytes.Load(),
+	}
+
+	if snap.CompressedRawBytes > 0 {
+		snap.CompressionRatio = float64(snap.CompressedWireBytes) / float64(snap.CompressedRawBytes)
+	}
+
+	return snap
+}
+
+// HandleMetrics performs no authentication and responds with a single JSON object
+// containing a snapshot of the server's Metrics.
+func (s *server) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	debug("Got metrics request")
+
+	snap := s.metrics.snapshot()
+
+	s.roomsMtx.RLock()
+	snap.Rooms = len(s.rooms)
+	s.roomsMtx.RUnlock()
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(snap)
+}
@@ -0,0 +1,195 @@
+package games
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/protocol"
+)
+
+// This file contains everything to do with the room's host and moderators: who they
+// are, and the requests only they may make (muting members and deleting messages).
+
+// moderatorsState builds the state message telling clients who the host and
+// moderators are.
+func (r *room) moderatorsState() *protocol.SetModeratorsState {
+	m := &protocol.SetModeratorsState{
+		Host:       r.host,
+		Moderators: make([]uuid.UUID, 0, len(r.moderators)),
+	}
+	for id := range r.moderators {
+		m.Moderators = append(m.Moderators, id)
+	}
+	return m
+}
+
+// isModerator returns true if the client is the host or a moderator.
+func (r *room) isModerator(c *Client) bool {
+	return c.ID == r.host || r.moderators[c.ID]
+}
+
+// forgetModerator is called when a member leaves the room for good, taking away their
+// moderator status and, if they were the host, handing it to a moderator or, failing
+// that, whoever else is left.
+func (r *room) forgetModerator(c *Client) {
+	changed := r.moderators[c.ID]
+	delete(r.moderators, c.ID)
+
+	if c.ID == r.host {
+		r.host = uuid.Nil
+		for _, m := range r.members {
+			if r.moderators[m.ID] {
+				r.host = m.ID
+				break
+			}
+		}
+		if r.host == uuid.Nil && len(r.members) > 0 {
+			r.host = r.members[0].ID
+		}
+		delete(r.moderators, r.host)
+		changed = true
+	}
+
+	if changed && len(r.members) > 0 {
+		r.broadcastState(r.moderatorsState(), true)
+		if c.ID != r.host && r.host != uuid.Nil {
+			r.postNote(protocol.ChatSystem, r.host, r.memberName(r.host)+" is now the host")
+		}
+	}
+}
+
+// memberName returns the name of a member, or "someone" if they are not in the room.
+func (r *room) memberName(id uuid.UUID) string {
+	if c := r.member(id); c != nil {
+		return c.Name
+	}
+	return "someone"
+}
+
+// member returns the member with the given ID, or nil if there is none.
+func (r *room) member(id uuid.UUID) *Client {
+	for _, c := range r.members {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// majority returns true if more than half of the people in the room voted. People are
+// counted once however many connections they have, and not at all while they are only
+// waiting to resume their session.
+func (r *room) majority(votes map[uuid.UUID]bool) bool {
+	present := make(map[uuid.UUID]bool, len(r.members))
+	for _, c := range r.members {
+		if c.session == nil || !c.session.detached() {
+			present[c.ID] = true
+		}
+	}
+
+	n := 0
+	for id := range present {
+		if votes[id] {
+			n++
+		}
+	}
+	return n*2 > len(present)
+}
+
+func (r *room) setModerator(src *Client, m *protocol.SetModeratorRequest) {
+	target := r.member(m.ID)
+	if src.ID != r.host || target == nil || target.ID == r.host || r.moderators[m.ID] == m.Moderator {
+		return
+	}
+
+	if m.Moderator {
+		if r.moderators == nil {
+			r.moderators = make(map[uuid.UUID]bool)
+		}
+		r.moderators[m.ID] = true
+		r.postNote(protocol.ChatSystem, m.ID, src.Name+" made "+target.Name+" a moderator")
+	} else {
+		delete(r.moderators, m.ID)
+		r.postNote(protocol.ChatSystem, m.ID, src.Name+" took away "+target.Name+"'s moderator status")
+	}
+	r.broadcastState(r.moderatorsState(), true)
+}
+
+func (r *room) muteMember(src *Client, m *protocol.MuteMemberRequest) {
+	target := r.member(m.ID)
+	if target == nil || !r.isModerator(src) || target == src {
+		return
+	}
+	// Moderators can only mute regular members; the host can mute anybody
+	if src.ID != r.host && r.isModerator(target) {
+		return
+	}
+
+	if m.Seconds == 0 {
+		if _, ok := r.mutes[m.ID]; ok {
+			delete(r.mutes, m.ID)
+			r.postNote(protocol.ChatSystem, m.ID, src.Name+" unmuted "+target.Name)
+		}
+		return
+	}
+
+	if r.mutes == nil {
+		r.mutes = make(map[uuid.UUID]time.Time)
+	}
+	r.mutes[m.ID] = time.Now().Add(time.Duration(m.Seconds) * time.Second)
+	r.postNote(protocol.ChatSystem, m.ID, src.Name+" muted "+target.Name+" for "+describeSeconds(m.Seconds))
+}
+
+// muted returns true if the client may not chat right now.
+func (r *room) muted(c *Client) bool {
+	until, ok := r.mutes[c.ID]
+	if ok && time.Now().After(until) {
+		delete(r.mutes, c.ID)
+		return false
+	}
+	return ok
+}
+
+func (r *room) deleteChatMessage(src *Client, m *protocol.DeleteChatMessageRequest) {
+	if !r.isModerator(src) {
+		return
+	}
+
+	// Moderators only get to delete messages they can see, which never includes
+	// direct messages
+	var cb *chatBuffer
+	if m.Channel == protocol.GlobalChannel {
+		cb = r.chat
+	} else if findChannel(src.channels, m.Channel) >= 0 {
+		cb = r.channels[m.Channel]
+	}
+
+	if cb == nil || !cb.deleteMessage(m.ID) {
+		return
+	}
+
+	r.debug("Client %q deleted message %d from channel %q", src.Name, m.ID, m.Channel)
+	r.broadcastStateTo(r.channelAudience(m.Channel), &protocol.DeleteChatMessageState{
+		Channel: m.Channel,
+		ID:      m.ID,
+	}, false)
+}
+
+// describeSeconds describes a duration for a system message, e.g., "5 minutes".
+func describeSeconds(s uint32) string {
+	switch {
+	case s%3600 == 0:
+		return plural(s/3600, "hour")
+	case s%60 == 0:
+		return plural(s/60, "minute")
+	}
+	return plural(s, "second")
+}
+
+func plural(n uint32, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return strconv.FormatUint(uint64(n), 10) + " " + unit + "s"
+}
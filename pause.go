@@ -0,0 +1,91 @@
+package games
+
+import (
+	"github.com/google/uuid"
+	"github.com/samclaus/games/protocol"
+)
+
+// This file contains pausing the current game, e.g., while someone steps away. The host
+// can pause or resume the game on their own, while anybody else's request counts as a
+// vote, and a majority of members have to vote for it. While the game is paused, the
+// room ignores game-scope requests and the game's timers stop (see game_timers.go).
+
+// votePause pauses or resumes the current game, or votes to if the member isn't the
+// host. Votes are only counted when they are cast, so members leaving never pauses or
+// resumes the game on its own.
+func (r *room) votePause(src *Client, pause bool) {
+	if r.currentGame == nil || r.paused == pause {
+		return
+	}
+
+	if src.ID != r.host {
+		if r.pauseVotes == nil {
+			r.pauseVotes = make(map[uuid.UUID]bool)
+		}
+		r.pauseVotes[src.ID] = true
+
+		if !r.majority(r.pauseVotes) {
+			r.broadcastState(r.pauseState(), false)
+			return
+		}
+	}
+
+	r.setPaused(src, pause)
+}
+
+// setPaused pauses or resumes the current game, which must not be nil, on behalf of
+// the given member.
+func (r *room) setPaused(src *Client, pause bool) {
+	r.paused = pause
+	r.pauseVotes = nil
+
+	verb := "resumed"
+	if pause {
+		verb = "paused"
+		r.pausedBy = src.ID
+		r.suspendTimers()
+	} else {
+		r.pausedBy = uuid.Nil
+		r.resumeTimers()
+	}
+
+	r.broadcastState(r.pauseState(), false)
+	r.postNote(protocol.ChatSystem, src.ID, src.Name+" "+verb+" "+r.currentGameID)
+
+	if p, ok := r.currentGame.(Pausable); ok {
+		if pause {
+			r.callGame("HandlePause", src, nil, func() { p.HandlePause(r.members) })
+		} else {
+			r.callGame("HandleResume", src, nil, func() { p.HandleResume(r.members) })
+		}
+	}
+}
+
+func (r *room) pauseState() *protocol.SetPauseState {
+	votes := make([]uuid.UUID, 0, len(r.pauseVotes))
+	for id := range r.pauseVotes {
+		votes = append(votes, id)
+	}
+
+	return &protocol.SetPauseState{
+		Paused: r.paused,
+		By:     r.pausedBy,
+		Votes:  votes,
+	}
+}
+
+// forgetPauseVote takes back the vote of a member who left the room, if they cast one.
+func (r *room) forgetPauseVote(c *Client) {
+	if r.pauseVotes[c.ID] {
+		delete(r.pauseVotes, c.ID)
+		r.broadcastState(r.pauseState(), false)
+	}
+}
+
+// resetPause unpauses the game and clears the votes without telling anybody, for when
+// the game is killed (clients know that a game always starts out unpaused).
+func (r *room) resetPause() {
+	r.paused = false
+	r.pausedBy = uuid.Nil
+	r.pauseVotes = nil
+}
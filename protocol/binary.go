@@ -0,0 +1,105 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/wire"
+)
+
+// AppendBinary appends the binary encoding of a room-scope message, including the scope
+// and type header, to dst. Strings which are too long for version 1 are cut short (at a
+// UTF-8 character boundary) rather than corrupting the rest of the message.
+func AppendBinary(dst []byte, v Version, m Message) []byte {
+	w := binaryWriter{newWriter(append(dst, ScopeRoom, m.Type()), v)}
+	m.Visit(&w)
+	return w.Bytes()
+}
+
+// DecodeBinaryState decodes a room-scope state message, including the scope and type
+// header, which is what a server sends to clients.
+func DecodeBinaryState(v Version, msg []byte) (Message, error) {
+	return decodeBinary(stateTypes, v, msg)
+}
+
+// DecodeBinaryRequest decodes a room-scope request, including the scope and type
+// header, which is what a client sends to the server.
+func DecodeBinaryRequest(v Version, msg []byte) (Message, error) {
+	return decodeBinary(requestTypes, v, msg)
+}
+
+func decodeBinary(types map[byte]func() Message, v Version, msg []byte) (Message, error) {
+	if len(msg) < 2 || msg[0] != ScopeRoom {
+		return nil, errors.New("protocol: not a room-scope message")
+	}
+
+	newMsg := types[msg[1]]
+	if newMsg == nil {
+		return nil, fmt.Errorf("protocol: unknown message type %d", msg[1])
+	}
+
+	m := newMsg()
+	r := binaryReader{newReader(msg[2:], v)}
+	m.Visit(&r)
+
+	if err := r.Done(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// newWriter returns a writer for the given version of the binary encoding, which only
+// differ in how string lengths are encoded.
+func newWriter(dst []byte, v Version) wire.Writer {
+	if v >= Version2 {
+		return wire.NewVarintWriter(dst)
+	}
+	return wire.NewWriter(dst)
+}
+
+func newReader(msg []byte, v Version) wire.Reader {
+	if v >= Version2 {
+		return wire.NewVarintReader(msg)
+	}
+	return wire.NewReader(msg)
+}
+
+// binaryWriter adapts wire.Writer to the Visitor interface.
+type binaryWriter struct {
+	wire.Writer
+}
+
+func (w *binaryWriter) U8(_ string, v *uint8)       { w.Writer.U8(*v) }
+func (w *binaryWriter) U16(_ string, v *uint16)     { w.Writer.U16(*v) }
+func (w *binaryWriter) U32(_ string, v *uint32)     { w.Writer.U32(*v) }
+func (w *binaryWriter) U64(_ string, v *uint64)     { w.Writer.U64(*v) }
+func (w *binaryWriter) UUID(_ string, v *uuid.UUID) { w.Writer.UUID(*v) }
+func (w *binaryWriter) Str(_ string, v *string)     { w.Writer.Str(*v) }
+func (w *binaryWriter) Tail(_ string, v *string)    { w.Writer.RawStr(*v) }
+
+func (w *binaryWriter) List(_ string, n int, item func(v Visitor, i int)) {
+	for i := 0; i < n; i++ {
+		item(w, i)
+	}
+}
+
+// binaryReader adapts wire.Reader to the Visitor interface. Once it runs into an error,
+// every field after that is left as the zero value.
+type binaryReader struct {
+	wire.Reader
+}
+
+func (r *binaryReader) U8(_ string, v *uint8)       { *v = r.Reader.U8() }
+func (r *binaryReader) U16(_ string, v *uint16)     { *v = r.Reader.U16() }
+func (r *binaryReader) U32(_ string, v *uint32)     { *v = r.Reader.U32() }
+func (r *binaryReader) U64(_ string, v *uint64)     { *v = r.Reader.U64() }
+func (r *binaryReader) UUID(_ string, v *uuid.UUID) { *v = r.Reader.UUID() }
+func (r *binaryReader) Str(_ string, v *string)     { *v = r.Reader.Str() }
+func (r *binaryReader) Tail(_ string, v *string)    { *v = string(r.Reader.Tail()) }
+
+func (r *binaryReader) List(_ string, _ int, item func(v Visitor, i int)) {
+	for i := 0; r.Err() == nil && r.Len() > 0; i++ {
+		item(r, i)
+	}
+}
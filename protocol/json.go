@@ -0,0 +1,266 @@
+package protocol
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Values of the "scope" key of every JSON message
+const (
+	jsonScopeRoom = "room"
+	jsonScopeGame = "game"
+)
+
+// JSONMessage is a decoded JSON message of either scope.
+type JSONMessage struct {
+	Scope byte
+
+	// Message is the decoded message; only set for room scope.
+	Message Message
+
+	// Payload is the game-scope message body (everything after the scope byte in the
+	// binary encoding), if it was sent as base64 under the "payload" key. Data is the
+	// game-scope message if it was instead embedded as JSON under the "data" key,
+	// which only works for games that opt in. Exactly one is set for game scope.
+	Payload []byte
+	Data    json.RawMessage
+}
+
+// AppendJSON appends the JSON encoding of a room-scope message to dst.
+func AppendJSON(dst []byte, m Message) []byte {
+	dst = append(dst, `{"scope":"`+jsonScopeRoom+`","type":`...)
+	dst = appendJSONString(dst, m.Name())
+
+	w := jsonWriter{buf: dst, comma: true}
+	m.Visit(&w)
+
+	return append(w.buf, '}')
+}
+
+// AppendGamePayloadJSON wraps a game-scope message body (everything after the scope byte
+// in the binary encoding) for JSON clients, as base64.
+func AppendGamePayloadJSON(dst []byte, body []byte) []byte {
+	dst = append(dst, `{"scope":"`+jsonScopeGame+`","payload":"`...)
+
+	n := len(dst)
+	dst = append(dst, make([]byte, base64.StdEncoding.EncodedLen(len(body)))...)
+	base64.StdEncoding.Encode(dst[n:], body)
+
+	return append(dst, `"}`...)
+}
+
+// AppendGameDataJSON wraps a game-scope message which the game already encoded as JSON
+// for JSON clients.
+func AppendGameDataJSON(dst []byte, data []byte) []byte {
+	dst = append(dst, `{"scope":"`+jsonScopeGame+`","data":`...)
+	dst = append(dst, data...)
+	return append(dst, '}')
+}
+
+// DecodeJSONState decodes a JSON state message, which is what a server sends to clients.
+func DecodeJSONState(data []byte) (JSONMessage, error) {
+	return decodeJSON(stateTypes, data)
+}
+
+// DecodeJSONRequest decodes a JSON request, which is what a client sends to the server.
+func DecodeJSONRequest(data []byte) (JSONMessage, error) {
+	return decodeJSON(requestTypes, data)
+}
+
+func decodeJSON(types map[byte]func() Message, data []byte) (JSONMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return JSONMessage{}, err
+	}
+
+	var scope, name string
+	r := jsonReader{fields: fields}
+	r.Str("scope", &scope)
+	r.Str("type", &name)
+
+	if r.err != nil {
+		return JSONMessage{}, r.err
+	}
+
+	switch scope {
+	case jsonScopeRoom:
+		m := lookupByName(types, name)
+		if m == nil {
+			return JSONMessage{}, fmt.Errorf("protocol: unknown message type %q", name)
+		}
+		if m.Visit(&r); r.err != nil {
+			return JSONMessage{}, r.err
+		}
+		return JSONMessage{Scope: ScopeRoom, Message: m}, nil
+	case jsonScopeGame:
+		if data, ok := fields["data"]; ok {
+			return JSONMessage{Scope: ScopeGame, Data: data}, nil
+		}
+
+		var payload []byte
+		if err := json.Unmarshal(fields["payload"], &payload); err != nil {
+			return JSONMessage{}, err
+		}
+		return JSONMessage{Scope: ScopeGame, Payload: payload}, nil
+	}
+
+	return JSONMessage{}, fmt.Errorf("protocol: unknown scope %q", scope)
+}
+
+type jsonWriter struct {
+	buf   []byte
+	comma bool // whether a comma is needed before the next key
+}
+
+func (w *jsonWriter) key(name string) {
+	if w.comma {
+		w.buf = append(w.buf, ',')
+	}
+	w.comma = true
+	w.buf = appendJSONString(w.buf, name)
+	w.buf = append(w.buf, ':')
+}
+
+func (w *jsonWriter) U8(name string, v *uint8) {
+	w.key(name)
+	w.buf = strconv.AppendUint(w.buf, uint64(*v), 10)
+}
+
+func (w *jsonWriter) U16(name string, v *uint16) {
+	w.key(name)
+	w.buf = strconv.AppendUint(w.buf, uint64(*v), 10)
+}
+
+func (w *jsonWriter) U32(name string, v *uint32) {
+	w.key(name)
+	w.buf = strconv.AppendUint(w.buf, uint64(*v), 10)
+}
+
+func (w *jsonWriter) U64(name string, v *uint64) {
+	w.key(name)
+	w.buf = strconv.AppendUint(w.buf, *v, 10)
+}
+
+func (w *jsonWriter) UUID(name string, v *uuid.UUID) {
+	w.key(name)
+	w.buf = append(w.buf, '"')
+	w.buf = append(w.buf, v.String()...)
+	w.buf = append(w.buf, '"')
+}
+
+func (w *jsonWriter) Str(name string, v *string) {
+	w.key(name)
+	w.buf = appendJSONString(w.buf, *v)
+}
+
+func (w *jsonWriter) Tail(name string, v *string) {
+	w.Str(name, v)
+}
+
+func (w *jsonWriter) List(name string, n int, item func(v Visitor, i int)) {
+	w.key(name)
+	w.buf = append(w.buf, '[')
+
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			w.buf = append(w.buf, ',')
+		}
+
+		elem := jsonWriter{buf: append(w.buf, '{')}
+		item(&elem, i)
+		w.buf = append(elem.buf, '}')
+	}
+
+	w.buf = append(w.buf, ']')
+}
+
+// jsonReader pulls fields out of an already-parsed JSON object. Missing fields are left
+// as the zero value, and once it runs into an error, every field after that is too.
+type jsonReader struct {
+	fields map[string]json.RawMessage
+	err    error
+}
+
+func (r *jsonReader) field(name string, v any) {
+	if raw, ok := r.fields[name]; ok && r.err == nil {
+		if err := json.Unmarshal(raw, v); err != nil {
+			r.err = fmt.Errorf("protocol: field %q: %w", name, err)
+		}
+	}
+}
+
+func (r *jsonReader) U8(name string, v *uint8)   { r.field(name, v) }
+func (r *jsonReader) U16(name string, v *uint16) { r.field(name, v) }
+func (r *jsonReader) U32(name string, v *uint32) { r.field(name, v) }
+func (r *jsonReader) U64(name string, v *uint64) { r.field(name, v) }
+func (r *jsonReader) Str(name string, v *string) { r.field(name, v) }
+
+func (r *jsonReader) Tail(name string, v *string) {
+	r.field(name, v)
+}
+
+func (r *jsonReader) UUID(name string, v *uuid.UUID) {
+	// uuid.UUID implements encoding.TextUnmarshaler, so it is decoded from a string
+	r.field(name, v)
+}
+
+func (r *jsonReader) List(name string, _ int, item func(v Visitor, i int)) {
+	var elems []map[string]json.RawMessage
+	if r.field(name, &elems); r.err != nil {
+		return
+	}
+
+	for i, fields := range elems {
+		elem := jsonReader{fields: fields}
+		if item(&elem, i); elem.err != nil {
+			r.err = elem.err
+			return
+		}
+	}
+}
+
+// appendJSONString appends s as a quoted JSON string, escaping as little as possible.
+// Invalid UTF-8 is replaced with U+FFFD, like encoding/json does.
+func appendJSONString(dst []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+
+	dst = append(dst, '"')
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				dst = append(dst, '\\', c)
+			case c == '\n':
+				dst = append(dst, '\\', 'n')
+			case c == '\r':
+				dst = append(dst, '\\', 'r')
+			case c == '\t':
+				dst = append(dst, '\\', 't')
+			case c < 0x20:
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			default:
+				dst = append(dst, c)
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, "\uFFFD"...)
+		} else {
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+
+	return append(dst, '"')
+}
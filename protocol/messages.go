@@ -0,0 +1,731 @@
+package protocol
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// This file contains the definition of every room-scope message. The comment on each
+// message type constant describes its fields in binary order. Any change here must also
+// be made to room.json, which CheckRoomSchema (and cmd/protogen) will complain about.
+//
+// In the binary encoding, all integer types are encoded big endian, UUIDs are always
+// 16 bytes (no string encoding), and strings are assumed to be UTF-8 and are prefixed
+// with their length: 1 byte in version 1, meaning their UTF-8 data must not exceed 255
+// bytes, or a varint in version 2.
+//
+// In the JSON encoding, every message is an object with "scope" and "type" keys
+// followed by its fields, UUIDs are strings, and lists are arrays of objects.
+
+const (
+	// Critical information for a client that has just joined the room.
+	//
+	// 1. uint32 room ID
+	// 2. UUID client ID
+	// 3. string room name
+	// 4. string current game (may be empty string if no game booted)
+	StateInit byte = iota
+	// Tells clients to UPDATE their information regarding the given members,
+	// i.e., do not delete information for members not included in the payload.
+	//
+	// 1 or more of:
+	//		1. UUID client ID
+	//		2. string client name
+	StateSetMembers
+	// Tells clients that the given members have left the room, i.e., disconnected.
+	//
+	// 1 or more of:
+	//		1. UUID client ID
+	StateDeleteMembers
+	// Chat history for a channel, meaning how many messages have been sent total plus
+	// the newest few messages. Clients get the history of every channel they can see
+	// when they join and whenever they can see a new one, and can ask for older
+	// messages with RequestOlderChatMessages.
+	//
+	// 1. string channel ID
+	// 2. uint64 total messages sent to the channel during life of room
+	// 3. 0 or more of:
+	//		1. uint64 message ID
+	//		2. uint64 time the server got the message, in Unix milliseconds
+	//		3. uint8 message kind (ChatPlayer, ChatSystem, ChatGame, or ChatDeleted)
+	//		4. UUID client ID that sent the message, or that a system message is about
+	//		5. string message contents
+	StateAllChatMessages
+	// Tells clients that a new message was just appended to a chat channel.
+	//
+	// 1. string channel ID
+	// 2. uint64 message ID
+	// 3. uint64 time the server got the message, in Unix milliseconds
+	// 4. uint8 message kind (ChatPlayer, ChatSystem, ChatGame, or ChatDeleted)
+	// 5. UUID client ID that sent the message, or that a system message is about
+	// 6. string message contents
+	StateNewChatMessage
+	// Tells clients that the game just changed (someone booted or killed game).
+	//
+	// 1. string current game ID (may be empty string if no game)
+	StateSetGame
+	// Tells a client which channels defined by the current game it can see, replacing
+	// whatever channels it was told about before. The global channel and direct
+	// message channels are not included.
+	//
+	// 0 or more of:
+	//		1. string channel ID
+	//		2. uint8 1 if the client may post to the channel, otherwise 0
+	StateSetChannels
+	// Tells clients who the room's host and moderators are. The host is whoever
+	// created the room, until they leave.
+	//
+	// 1. UUID client ID of the host
+	// 2. 0 or more of:
+	//		1. UUID client ID of a moderator
+	StateSetModerators
+	// Tells clients that a moderator deleted a chat message. It stays in the channel's
+	// history as a message of kind ChatDeleted, with no contents or reactions.
+	//
+	// 1. string channel ID
+	// 2. uint64 message ID
+	StateDeleteChatMessage
+	// Answers RequestOlderChatMessages with the page of messages before the given ID,
+	// oldest first. There are no older messages left once a page comes back empty.
+	//
+	// 1. string channel ID
+	// 2. uint64 message ID the page is before, as given in the request
+	// 3. 0 or more of (same as StateAllChatMessages):
+	//		1. uint64 message ID
+	//		2. uint64 time the server got the message, in Unix milliseconds
+	//		3. uint8 message kind (ChatPlayer, ChatSystem, ChatGame, or ChatDeleted)
+	//		4. UUID client ID that sent the message, or that a system message is about
+	//		5. string message contents
+	StateOlderChatMessages
+	// Every reaction to the messages in the StateAllChatMessages or
+	// StateOlderChatMessages sent right before it, one per member who reacted, if any
+	// of the messages have reactions. Clients add them up per message and emoji.
+	//
+	// 1. string channel ID
+	// 2. 1 or more of:
+	//		1. uint64 message ID
+	//		2. string emoji
+	//		3. UUID client ID of the member who reacted
+	StateChatReactions
+	// Tells clients which members have reacted to a chat message with an emoji, after
+	// one of them added or took back their reaction, replacing whatever members they
+	// were told about before for that message and emoji.
+	//
+	// 1. string channel ID
+	// 2. uint64 message ID
+	// 3. string emoji
+	// 4. 0 or more of:
+	//		1. UUID client ID of a member who reacted
+	StateSetReaction
+	// Tells clients that the current game crashed because of a bug in it, so the room
+	// shut it down. A StateSetGame with no game follows.
+	//
+	// 1. string ID of the game that crashed
+	StateGameCrashed
+	// Tells clients whether the current game is paused, and who voted to pause it (or
+	// to resume it, if it is paused). Game-scope requests are ignored while the game is
+	// paused. Booting or killing a game always unpauses it and clears the votes.
+	//
+	// 1. uint8 1 if the game is paused, otherwise 0
+	// 2. UUID client ID of the member who paused it (the host, or whoever cast the
+	//    deciding vote), or nil if it is not paused
+	// 3. 0 or more of:
+	//		1. UUID client ID of a member who voted
+	StateSetPause
+	// Tells clients who voted to undo the last move in the current game. Votes are
+	// cleared once the move is undone, or once the game accepts another request.
+	// Booting or killing a game always clears them.
+	//
+	// 0 or more of:
+	//		1. UUID client ID of a member who voted
+	StateSetUndoVotes
+)
+
+// Chat channel IDs. Besides these, games may define channels with any ID that does not
+// start with DirectChannelPrefix, such as one for each team.
+const (
+	// GlobalChannel is the channel every member of the room can see and post to,
+	// which system messages and game narration always go to.
+	GlobalChannel = ""
+	// DirectChannelPrefix starts the IDs of channels between two members (see
+	// DirectChannel).
+	DirectChannelPrefix = "dm:"
+)
+
+// DirectChannel returns the ID of the channel for direct messages between two members,
+// which is the same no matter which order they are given in.
+func DirectChannel(a, b uuid.UUID) string {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return DirectChannelPrefix + a.String() + ":" + b.String()
+}
+
+// ParseDirectChannel returns the members a direct message channel is between, or ok ==
+// false if the ID is not a direct message channel.
+func ParseDirectChannel(id string) (a, b uuid.UUID, ok bool) {
+	if !strings.HasPrefix(id, DirectChannelPrefix) {
+		return a, b, false
+	}
+	first, second, found := strings.Cut(id[len(DirectChannelPrefix):], ":")
+	if !found {
+		return a, b, false
+	}
+	a, errA := uuid.Parse(first)
+	b, errB := uuid.Parse(second)
+	return a, b, errA == nil && errB == nil
+}
+
+const (
+	// Boots a game, if no game is currently booted.
+	//
+	// 1. game ID, taking up the rest of the message
+	RequestBootGame byte = iota
+	// Kills the current game, if there is one. No fields.
+	RequestKillGame
+	// Appends a message to the room's global chat channel.
+	//
+	// 1. message contents, taking up the rest of the message
+	RequestMessageChat
+	// Appends a message to a channel defined by the current game, if the client may
+	// post to it.
+	//
+	// 1. string channel ID
+	// 2. message contents, taking up the rest of the message
+	RequestMessageChannel
+	// Sends a direct message to another member, unless the current game forbids it.
+	//
+	// 1. UUID client ID of the recipient
+	// 2. message contents, taking up the rest of the message
+	RequestMessageDirect
+	// Makes a member a moderator, or not. Only the host may do this.
+	//
+	// 1. UUID client ID of the member
+	// 2. uint8 1 to make them a moderator, 0 to take it away
+	RequestSetModerator
+	// Stops a member from chatting for a while. Only the host and moderators may do
+	// this, and moderators may not mute the host or each other.
+	//
+	// 1. UUID client ID of the member
+	// 2. uint32 seconds to mute them for, or 0 to unmute them
+	RequestMuteMember
+	// Deletes a chat message from the global channel or a channel defined by the
+	// current game. Only the host and moderators may do this.
+	//
+	// 1. string channel ID
+	// 2. uint64 message ID
+	RequestDeleteChatMessage
+	// Asks for a page of messages from a channel the client can see, older than the
+	// given message ID.
+	//
+	// 1. string channel ID
+	// 2. uint64 message ID
+	RequestOlderChatMessages
+	// Adds a reaction to a chat message in a channel the client can see, or takes it
+	// back if the client already reacted with the same emoji.
+	//
+	// 1. string channel ID
+	// 2. uint64 message ID
+	// 3. string emoji
+	RequestToggleReaction
+	// Pauses the current game if sent by the host, otherwise votes to pause it; it is
+	// paused once a majority of members vote to. No fields.
+	RequestPauseGame
+	// Resumes the current game if sent by the host, otherwise votes to resume it; it is
+	// resumed once a majority of members vote to. No fields.
+	RequestResumeGame
+	// Undoes the last move in the current game if sent by the host, otherwise votes to;
+	// it is undone once a majority of members vote to. Only works for games that support
+	// it, and not while the game is paused. No fields.
+	RequestUndo
+)
+
+func init() {
+	registerState(func() Message { return &InitState{} })
+	registerState(func() Message { return &SetMembersState{} })
+	registerState(func() Message { return &DeleteMembersState{} })
+	registerState(func() Message { return &AllChatMessagesState{} })
+	registerState(func() Message { return &NewChatMessageState{} })
+	registerState(func() Message { return &SetGameState{} })
+	registerState(func() Message { return &SetChannelsState{} })
+	registerState(func() Message { return &SetModeratorsState{} })
+	registerState(func() Message { return &DeleteChatMessageState{} })
+	registerState(func() Message { return &OlderChatMessagesState{} })
+	registerState(func() Message { return &ChatReactionsState{} })
+	registerState(func() Message { return &SetReactionState{} })
+	registerState(func() Message { return &GameCrashedState{} })
+	registerState(func() Message { return &SetPauseState{} })
+	registerState(func() Message { return &SetUndoVotesState{} })
+
+	registerRequest(func() Message { return &BootGameRequest{} })
+	registerRequest(func() Message { return &KillGameRequest{} })
+	registerRequest(func() Message { return &MessageChatRequest{} })
+	registerRequest(func() Message { return &MessageChannelRequest{} })
+	registerRequest(func() Message { return &MessageDirectRequest{} })
+	registerRequest(func() Message { return &SetModeratorRequest{} })
+	registerRequest(func() Message { return &MuteMemberRequest{} })
+	registerRequest(func() Message { return &DeleteChatMessageRequest{} })
+	registerRequest(func() Message { return &OlderChatMessagesRequest{} })
+	registerRequest(func() Message { return &ToggleReactionRequest{} })
+	registerRequest(func() Message { return &PauseGameRequest{} })
+	registerRequest(func() Message { return &ResumeGameRequest{} })
+	registerRequest(func() Message { return &UndoRequest{} })
+}
+
+type InitState struct {
+	RoomID   uint32
+	ClientID uuid.UUID
+	RoomName string
+	GameID   string
+}
+
+func (*InitState) Type() byte   { return StateInit }
+func (*InitState) Name() string { return "init" }
+
+func (m *InitState) Visit(v Visitor) {
+	v.U32("room_id", &m.RoomID)
+	v.UUID("client_id", &m.ClientID)
+	v.Str("room_name", &m.RoomName)
+	v.Str("game_id", &m.GameID)
+}
+
+type Member struct {
+	ID   uuid.UUID
+	Name string
+}
+
+type SetMembersState struct {
+	Members []Member
+}
+
+func (*SetMembersState) Type() byte   { return StateSetMembers }
+func (*SetMembersState) Name() string { return "set_members" }
+
+func (m *SetMembersState) Visit(v Visitor) {
+	v.List("members", len(m.Members), func(v Visitor, i int) {
+		if i == len(m.Members) {
+			m.Members = append(m.Members, Member{})
+		}
+		v.UUID("id", &m.Members[i].ID)
+		v.Str("name", &m.Members[i].Name)
+	})
+}
+
+type DeleteMembersState struct {
+	IDs []uuid.UUID
+}
+
+func (*DeleteMembersState) Type() byte   { return StateDeleteMembers }
+func (*DeleteMembersState) Name() string { return "delete_members" }
+
+func (m *DeleteMembersState) Visit(v Visitor) {
+	v.List("members", len(m.IDs), func(v Visitor, i int) {
+		if i == len(m.IDs) {
+			m.IDs = append(m.IDs, uuid.UUID{})
+		}
+		v.UUID("id", &m.IDs[i])
+	})
+}
+
+// Kinds of chat messages.
+const (
+	// ChatPlayer is a message typed by a member, who is the message's source.
+	ChatPlayer byte = iota
+	// ChatSystem is a message from the room itself, usually about something a member
+	// did, like joining or booting a game. The member is the message's source, or the
+	// nil UUID if it is not about anyone in particular (like a game ending itself).
+	ChatSystem
+	// ChatGame is narration from the current game, like which card was just revealed.
+	// The source is the nil UUID.
+	ChatGame
+	// ChatDeleted is a message which was deleted by a moderator. Its contents are gone,
+	// but the source is still whoever sent it.
+	ChatDeleted
+)
+
+type ChatMessage struct {
+	// ID counts up from 0 over the life of the room, separately for each channel, so
+	// clients can tell messages apart and put them in order.
+	ID uint64
+	// Time is when the server got the message, in Unix milliseconds.
+	Time    uint64
+	Kind    byte
+	Src     uuid.UUID
+	Content string
+}
+
+func (m *ChatMessage) visit(v Visitor) {
+	v.U64("id", &m.ID)
+	v.U64("time", &m.Time)
+	v.U8("kind", &m.Kind)
+	v.UUID("src", &m.Src)
+	v.Str("content", &m.Content)
+}
+
+type AllChatMessagesState struct {
+	Channel  string
+	History  uint64
+	Messages []ChatMessage
+}
+
+func (*AllChatMessagesState) Type() byte   { return StateAllChatMessages }
+func (*AllChatMessagesState) Name() string { return "all_chat_messages" }
+
+func (m *AllChatMessagesState) Visit(v Visitor) {
+	v.Str("channel", &m.Channel)
+	v.U64("history", &m.History)
+	v.List("messages", len(m.Messages), func(v Visitor, i int) {
+		if i == len(m.Messages) {
+			m.Messages = append(m.Messages, ChatMessage{})
+		}
+		m.Messages[i].visit(v)
+	})
+}
+
+type NewChatMessageState struct {
+	Channel string
+	ChatMessage
+}
+
+func (*NewChatMessageState) Type() byte   { return StateNewChatMessage }
+func (*NewChatMessageState) Name() string { return "new_chat_message" }
+
+func (m *NewChatMessageState) Visit(v Visitor) {
+	v.Str("channel", &m.Channel)
+	m.ChatMessage.visit(v)
+}
+
+type SetGameState struct {
+	GameID string
+}
+
+func (*SetGameState) Type() byte   { return StateSetGame }
+func (*SetGameState) Name() string { return "set_game" }
+
+func (m *SetGameState) Visit(v Visitor) {
+	v.Str("game_id", &m.GameID)
+}
+
+// Channel is a chat channel defined by the current game.
+type Channel struct {
+	ID      string
+	CanPost bool
+}
+
+type SetChannelsState struct {
+	Channels []Channel
+}
+
+func (*SetChannelsState) Type() byte   { return StateSetChannels }
+func (*SetChannelsState) Name() string { return "set_channels" }
+
+func (m *SetChannelsState) Visit(v Visitor) {
+	v.List("channels", len(m.Channels), func(v Visitor, i int) {
+		if i == len(m.Channels) {
+			m.Channels = append(m.Channels, Channel{})
+		}
+		canPost := boolByte(m.Channels[i].CanPost)
+		v.Str("id", &m.Channels[i].ID)
+		v.U8("can_post", &canPost)
+		m.Channels[i].CanPost = canPost != 0
+	})
+}
+
+type SetModeratorsState struct {
+	Host       uuid.UUID
+	Moderators []uuid.UUID
+}
+
+func (*SetModeratorsState) Type() byte   { return StateSetModerators }
+func (*SetModeratorsState) Name() string { return "set_moderators" }
+
+func (m *SetModeratorsState) Visit(v Visitor) {
+	v.UUID("host", &m.Host)
+	v.List("moderators", len(m.Moderators), func(v Visitor, i int) {
+		if i == len(m.Moderators) {
+			m.Moderators = append(m.Moderators, uuid.UUID{})
+		}
+		v.UUID("id", &m.Moderators[i])
+	})
+}
+
+type DeleteChatMessageState struct {
+	Channel string
+	ID      uint64
+}
+
+func (*DeleteChatMessageState) Type() byte   { return StateDeleteChatMessage }
+func (*DeleteChatMessageState) Name() string { return "delete_chat_message" }
+
+func (m *DeleteChatMessageState) Visit(v Visitor) {
+	v.Str("channel", &m.Channel)
+	v.U64("id", &m.ID)
+}
+
+type OlderChatMessagesState struct {
+	Channel  string
+	Before   uint64
+	Messages []ChatMessage
+}
+
+func (*OlderChatMessagesState) Type() byte   { return StateOlderChatMessages }
+func (*OlderChatMessagesState) Name() string { return "older_chat_messages" }
+
+func (m *OlderChatMessagesState) Visit(v Visitor) {
+	v.Str("channel", &m.Channel)
+	v.U64("before", &m.Before)
+	v.List("messages", len(m.Messages), func(v Visitor, i int) {
+		if i == len(m.Messages) {
+			m.Messages = append(m.Messages, ChatMessage{})
+		}
+		m.Messages[i].visit(v)
+	})
+}
+
+// Reaction is one member's reaction to a chat message.
+type Reaction struct {
+	ID     uint64 // message ID
+	Emoji  string
+	Member uuid.UUID
+}
+
+type ChatReactionsState struct {
+	Channel   string
+	Reactions []Reaction
+}
+
+func (*ChatReactionsState) Type() byte   { return StateChatReactions }
+func (*ChatReactionsState) Name() string { return "chat_reactions" }
+
+func (m *ChatReactionsState) Visit(v Visitor) {
+	v.Str("channel", &m.Channel)
+	v.List("reactions", len(m.Reactions), func(v Visitor, i int) {
+		if i == len(m.Reactions) {
+			m.Reactions = append(m.Reactions, Reaction{})
+		}
+		v.U64("id", &m.Reactions[i].ID)
+		v.Str("emoji", &m.Reactions[i].Emoji)
+		v.UUID("member", &m.Reactions[i].Member)
+	})
+}
+
+type SetReactionState struct {
+	Channel string
+	ID      uint64
+	Emoji   string
+	Members []uuid.UUID
+}
+
+func (*SetReactionState) Type() byte   { return StateSetReaction }
+func (*SetReactionState) Name() string { return "set_reaction" }
+
+func (m *SetReactionState) Visit(v Visitor) {
+	v.Str("channel", &m.Channel)
+	v.U64("id", &m.ID)
+	v.Str("emoji", &m.Emoji)
+	v.List("members", len(m.Members), func(v Visitor, i int) {
+		if i == len(m.Members) {
+			m.Members = append(m.Members, uuid.UUID{})
+		}
+		v.UUID("id", &m.Members[i])
+	})
+}
+
+type GameCrashedState struct {
+	GameID string
+}
+
+func (*GameCrashedState) Type() byte   { return StateGameCrashed }
+func (*GameCrashedState) Name() string { return "game_crashed" }
+
+func (m *GameCrashedState) Visit(v Visitor) {
+	v.Str("game_id", &m.GameID)
+}
+
+type SetPauseState struct {
+	Paused bool
+	By     uuid.UUID
+	Votes  []uuid.UUID
+}
+
+func (*SetPauseState) Type() byte   { return StateSetPause }
+func (*SetPauseState) Name() string { return "set_pause" }
+
+func (m *SetPauseState) Visit(v Visitor) {
+	paused := boolByte(m.Paused)
+	v.U8("paused", &paused)
+	m.Paused = paused != 0
+	v.UUID("by", &m.By)
+	v.List("votes", len(m.Votes), func(v Visitor, i int) {
+		if i == len(m.Votes) {
+			m.Votes = append(m.Votes, uuid.UUID{})
+		}
+		v.UUID("id", &m.Votes[i])
+	})
+}
+
+type SetUndoVotesState struct {
+	Votes []uuid.UUID
+}
+
+func (*SetUndoVotesState) Type() byte   { return StateSetUndoVotes }
+func (*SetUndoVotesState) Name() string { return "set_undo_votes" }
+
+func (m *SetUndoVotesState) Visit(v Visitor) {
+	v.List("votes", len(m.Votes), func(v Visitor, i int) {
+		if i == len(m.Votes) {
+			m.Votes = append(m.Votes, uuid.UUID{})
+		}
+		v.UUID("id", &m.Votes[i])
+	})
+}
+
+type BootGameRequest struct {
+	GameID string
+}
+
+func (*BootGameRequest) Type() byte   { return RequestBootGame }
+func (*BootGameRequest) Name() string { return "boot_game" }
+
+func (m *BootGameRequest) Visit(v Visitor) {
+	v.Tail("game_id", &m.GameID)
+}
+
+type KillGameRequest struct{}
+
+func (*KillGameRequest) Type() byte      { return RequestKillGame }
+func (*KillGameRequest) Name() string    { return "kill_game" }
+func (*KillGameRequest) Visit(v Visitor) {}
+
+type MessageChatRequest struct {
+	Content string
+}
+
+func (*MessageChatRequest) Type() byte   { return RequestMessageChat }
+func (*MessageChatRequest) Name() string { return "message_chat" }
+
+func (m *MessageChatRequest) Visit(v Visitor) {
+	v.Tail("content", &m.Content)
+}
+
+type MessageChannelRequest struct {
+	Channel string
+	Content string
+}
+
+func (*MessageChannelRequest) Type() byte   { return RequestMessageChannel }
+func (*MessageChannelRequest) Name() string { return "message_channel" }
+
+func (m *MessageChannelRequest) Visit(v Visitor) {
+	v.Str("channel", &m.Channel)
+	v.Tail("content", &m.Content)
+}
+
+type MessageDirectRequest struct {
+	To      uuid.UUID
+	Content string
+}
+
+func (*MessageDirectRequest) Type() byte   { return RequestMessageDirect }
+func (*MessageDirectRequest) Name() string { return "message_direct" }
+
+func (m *MessageDirectRequest) Visit(v Visitor) {
+	v.UUID("to", &m.To)
+	v.Tail("content", &m.Content)
+}
+
+type SetModeratorRequest struct {
+	ID        uuid.UUID
+	Moderator bool
+}
+
+func (*SetModeratorRequest) Type() byte   { return RequestSetModerator }
+func (*SetModeratorRequest) Name() string { return "set_moderator" }
+
+func (m *SetModeratorRequest) Visit(v Visitor) {
+	moderator := boolByte(m.Moderator)
+	v.UUID("id", &m.ID)
+	v.U8("moderator", &moderator)
+	m.Moderator = moderator != 0
+}
+
+type MuteMemberRequest struct {
+	ID      uuid.UUID
+	Seconds uint32
+}
+
+func (*MuteMemberRequest) Type() byte   { return RequestMuteMember }
+func (*MuteMemberRequest) Name() string { return "mute_member" }
+
+func (m *MuteMemberRequest) Visit(v Visitor) {
+	v.UUID("id", &m.ID)
+	v.U32("seconds", &m.Seconds)
+}
+
+type DeleteChatMessageRequest struct {
+	Channel string
+	ID      uint64
+}
+
+func (*DeleteChatMessageRequest) Type() byte   { return RequestDeleteChatMessage }
+func (*DeleteChatMessageRequest) Name() string { return "delete_chat_message" }
+
+func (m *DeleteChatMessageRequest) Visit(v Visitor) {
+	v.Str("channel", &m.Channel)
+	v.U64("id", &m.ID)
+}
+
+type OlderChatMessagesRequest struct {
+	Channel string
+	Before  uint64
+}
+
+func (*OlderChatMessagesRequest) Type() byte   { return RequestOlderChatMessages }
+func (*OlderChatMessagesRequest) Name() string { return "older_chat_messages" }
+
+func (m *OlderChatMessagesRequest) Visit(v Visitor) {
+	v.Str("channel", &m.Channel)
+	v.U64("before", &m.Before)
+}
+
+type ToggleReactionRequest struct {
+	Channel string
+	ID      uint64
+	Emoji   string
+}
+
+func (*ToggleReactionRequest) Type() byte   { return RequestToggleReaction }
+func (*ToggleReactionRequest) Name() string { return "toggle_reaction" }
+
+func (m *ToggleReactionRequest) Visit(v Visitor) {
+	v.Str("channel", &m.Channel)
+	v.U64("id", &m.ID)
+	v.Str("emoji", &m.Emoji)
+}
+
+type PauseGameRequest struct{}
+
+func (*PauseGameRequest) Type() byte      { return RequestPauseGame }
+func (*PauseGameRequest) Name() string    { return "pause_game" }
+func (*PauseGameRequest) Visit(v Visitor) {}
+
+type ResumeGameRequest struct{}
+
+func (*ResumeGameRequest) Type() byte      { return RequestResumeGame }
+func (*ResumeGameRequest) Name() string    { return "resume_game" }
+func (*ResumeGameRequest) Visit(v Visitor) {}
+
+type UndoRequest struct{}
+
+func (*UndoRequest) Type() byte      { return RequestUndo }
+func (*UndoRequest) Name() string    { return "undo" }
+func (*UndoRequest) Visit(v Visitor) {}
+
+func boolByte(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+// Package protocol defines every room-scope message exchanged between a games server
+// and its clients, along with the binary and JSON encodings of those messages.
+//
+// Each message is defined exactly once, by a Visit method which walks over its fields
+// in order. The binary and JSON encoders and decoders are all just Visitors, so the two
+// encodings cannot drift apart from each other.
+//
+// Every message starts with a scope, which says whether it is meant for the room itself
+// or for whatever game is currently booted. Room-scope messages are followed by a
+// message type, and game-scope messages are entirely up to the game (which is why this
+// package only deals with wrapping them up for JSON clients).
+//
+// The binary encoding has two versions. Version 1, which is what clients get unless they
+// ask for something else, prefixes strings with a single length byte, so any string
+// longer than 255 bytes gets cut short. Version 2 prefixes strings with a varint length
+// instead (see encoding/binary.AppendUvarint) and is otherwise identical.
+//
+// Clients that ask for sequencing when joining a room get every message (of either
+// scope) prefixed with a uint32 sequence number, starting at 1, in the binary
+// encoding, or with an extra "seq" key as the first key of the object in the JSON
+// encoding.
+package protocol
+
+import (
+	"github.com/google/uuid"
+	"github.com/samclaus/games/wire"
+)
+
+const (
+	// ScopeRoom means a request/event is intended for the room itself, not whatever
+	// game (if any) is in progress.
+	ScopeRoom byte = iota
+	// ScopeGame means a request/event is intended for the current game.
+	ScopeGame
+)
+
+// WebSocket subprotocols a client can ask for when connecting. Clients which do not
+// ask for a subprotocol get version 1 of the binary encoding. Clients which support
+// several versions should offer all of them, so that they still work with servers which
+// do not know about the newer ones; the server picks the newest version it knows.
+const (
+	SubprotocolBinary   = "games.binary"
+	SubprotocolBinaryV2 = "games.binary.v2"
+	SubprotocolJSON     = "games.json"
+)
+
+// Version is a version of the binary encoding.
+type Version uint8
+
+const (
+	Version1 Version = 1 + iota
+	Version2
+)
+
+// MaxStrLenV1 is the longest string, in bytes, which can be sent to clients using
+// version 1 of the binary encoding without getting cut short.
+const MaxStrLenV1 = wire.MaxShortLen
+
+// Message is a room-scope state message or request.
+type Message interface {
+	// Type is the message type, which follows the scope in the binary encoding.
+	Type() byte
+	// Name identifies the message type in the JSON encoding, e.g., "set_members".
+	Name() string
+	// Visit calls the visitor once for each field of the message, in order. Visiting
+	// must work whether the visitor is reading the fields (to encode them) or writing
+	// them (to decode them), so fields are passed by pointer.
+	Visit(v Visitor)
+}
+
+// Visitor is implemented by each encoder and decoder. Every method is given the name of
+// the field (used as the JSON object key) and a pointer to its value.
+type Visitor interface {
+	U8(name string, v *uint8)
+	U16(name string, v *uint16)
+	U32(name string, v *uint32)
+	// U64 is encoded as a JSON number, so values above 2^53 lose precision in
+	// JavaScript clients.
+	U64(name string, v *uint64)
+	UUID(name string, v *uuid.UUID)
+	// Str is a length-prefixed UTF-8 string; how the length is encoded depends on the
+	// version of the binary encoding.
+	Str(name string, v *string)
+	// Tail is a UTF-8 string taking up the remainder of a binary message, so it does
+	// not need a length prefix. It MUST be the last field of the message.
+	Tail(name string, v *string)
+	// List visits a sequence of items taking up the remainder of a binary message (so
+	// it MUST be the last field of the message), or a JSON array of objects. When
+	// encoding, n is the number of items. When decoding, n is ignored and item will be
+	// called with i == len(items) each time a new item needs to be appended. The
+	// visitor passed to item visits the fields of a single item.
+	List(name string, n int, item func(v Visitor, i int))
+}
+
+// Every room-scope message type, keyed by type byte, for decoding.
+var (
+	stateTypes   = map[byte]func() Message{}
+	requestTypes = map[byte]func() Message{}
+)
+
+func registerState(newMsg func() Message) {
+	stateTypes[newMsg().Type()] = newMsg
+}
+
+func registerRequest(newMsg func() Message) {
+	requestTypes[newMsg().Type()] = newMsg
+}
+
+func lookupByName(types map[byte]func() Message, name string) Message {
+	for _, newMsg := range types {
+		if m := newMsg(); m.Name() == name {
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package protocol
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Schema is a machine-readable description of every message in a protocol: either the
+// room protocol (see RoomSchema) or the protocol of a single game. Schemas are written by
+// hand, as JSON, and are what client code gets generated from (see cmd/protogen), so they
+// are checked against the Go encoders rather than the other way around.
+type Schema struct {
+	// Name is "room" for the room protocol and the game ID for games.
+	Name string `json:"name"`
+	// Scope is "room" or "game", i.e., the byte every message of this protocol starts
+	// with.
+	Scope string `json:"scope"`
+	// Version is the version of the binary encoding that a game's messages always use,
+	// whichever version the client asked for, because games encode their own messages;
+	// version 1 if zero. Room messages are encoded in the client's version, so the room
+	// schema leaves it out.
+	Version  Version         `json:"version,omitempty"`
+	States   []MessageSchema `json:"states"`
+	Requests []MessageSchema `json:"requests"`
+}
+
+// MessageSchema describes a single message type. In the binary encoding, every message
+// is the scope byte, the type byte, and then its fields in order.
+type MessageSchema struct {
+	Name   string  `json:"name"`
+	Type   byte    `json:"type"`
+	Doc    string  `json:"doc,omitempty"`
+	Fields []Field `json:"fields"`
+}
+
+// Field describes a single field of a message, or a single value nested in one.
+type Field struct {
+	Name string `json:"name,omitempty"`
+	Kind Kind   `json:"kind"`
+	Doc  string `json:"doc,omitempty"`
+	// Fields are the fields of each item of a KindList, or the keys of a KindObject.
+	Fields []Field `json:"fields,omitempty"`
+	// Elem is the JSON value of a KindJSON, or the elements of a KindArray or
+	// KindRecord.
+	Elem *Field `json:"elem,omitempty"`
+	// Count is the number of elements of a KindArray in a binary message, which is
+	// fixed. (JSON arrays can have any number of elements.)
+	Count int `json:"count,omitempty"`
+}
+
+// Kind is the type of a field.
+type Kind string
+
+// Kinds of binary fields, which match up with the methods of Visitor
+const (
+	KindU8   Kind = "u8"
+	KindU16  Kind = "u16"
+	KindU32  Kind = "u32"
+	KindU64  Kind = "u64"
+	KindUUID Kind = "uuid"
+	KindStr  Kind = "str"
+	KindTail Kind = "tail"
+	KindList Kind = "list"
+	// KindJSON is a JSON value taking up the rest of the message, which games use when
+	// they cannot be bothered with a binary format.
+	KindJSON Kind = "json"
+)
+
+// Kinds of values nested inside a KindJSON field. KindBoolean (a single byte) and
+// KindArray (a fixed number of elements, one after another) may be used in binary
+// messages too.
+const (
+	KindNumber  Kind = "number"
+	KindString  Kind = "string"
+	KindBoolean Kind = "boolean"
+	KindArray   Kind = "array"
+	KindObject  Kind = "object"
+	// KindRecord is an object used as a map, with arbitrary string keys.
+	KindRecord Kind = "record"
+)
+
+//go:embed room.json
+var roomSchemaJSON []byte
+
+// RoomSchema returns the description of the room protocol.
+func RoomSchema() Schema {
+	return MustParseSchema(roomSchemaJSON)
+}
+
+// MustParseSchema parses a JSON schema, panicking if it is malformed. It is meant for
+// schemas embedded in the binary, which are only malformed if the code is broken.
+func MustParseSchema(data []byte) Schema {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		panic("protocol: malformed schema: " + err.Error())
+	}
+	return s
+}
+
+// CheckRoomSchema returns an error if RoomSchema does not match the messages defined in
+// this package, i.e., the Visit method of every message.
+func CheckRoomSchema() error {
+	s := RoomSchema()
+
+	if err := checkMessages("state", s.States, stateTypes); err != nil {
+		return err
+	}
+	return checkMessages("request", s.Requests, requestTypes)
+}
+
+func checkMessages(what string, described []MessageSchema, types map[byte]func() Message) error {
+	seen := make(map[byte]bool, len(described))
+
+	for _, ms := range described {
+		newMsg := types[ms.Type]
+		if newMsg == nil {
+			return fmt.Errorf("protocol: %s %q (%d) is not defined", what, ms.Name, ms.Type)
+		}
+
+		actual := DescribeMessage(newMsg())
+
+		if actual.Name != ms.Name || signature(actual.Fields) != signature(ms.Fields) {
+			return fmt.Errorf(
+				"protocol: %s %d is described as %s %s but is actually %s %s",
+				what, ms.Type, ms.Name, signature(ms.Fields), actual.Name, signature(actual.Fields),
+			)
+		}
+		seen[ms.Type] = true
+	}
+
+	var missing []int
+	for t := range types {
+		if !seen[t] {
+			missing = append(missing, int(t))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Ints(missing)
+		return fmt.Errorf("protocol: %s types %v are not described", what, missing)
+	}
+
+	return nil
+}
+
+// signature summarizes fields, ignoring docs, e.g., "{id uuid, name str}".
+func signature(fields []Field) string {
+	var sb strings.Builder
+	writeSignature(&sb, fields)
+	return sb.String()
+}
+
+func writeSignature(sb *strings.Builder, fields []Field) {
+	sb.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		if f.Name != "" {
+			sb.WriteString(f.Name)
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(string(f.Kind))
+		if f.Fields != nil {
+			writeSignature(sb, f.Fields)
+		}
+		if f.Count != 0 {
+			fmt.Fprintf(sb, "[%d]", f.Count)
+		}
+		if f.Elem != nil {
+			writeSignature(sb, []Field{*f.Elem})
+		}
+	}
+	sb.WriteByte('}')
+}
+
+// DescribeMessage describes a message by visiting its fields.
+func DescribeMessage(m Message) MessageSchema {
+	var d describer
+	m.Visit(&d)
+	return MessageSchema{Name: m.Name(), Type: m.Type(), Fields: d.fields}
+}
+
+type describer struct {
+	fields []Field
+}
+
+func (d *describer) add(name string, kind Kind) {
+	d.fields = append(d.fields, Field{Name: name, Kind: kind})
+}
+
+func (d *describer) U8(name string, _ *uint8)       { d.add(name, KindU8) }
+func (d *describer) U16(name string, _ *uint16)     { d.add(name, KindU16) }
+func (d *describer) U32(name string, _ *uint32)     { d.add(name, KindU32) }
+func (d *describer) U64(name string, _ *uint64)     { d.add(name, KindU64) }
+func (d *describer) UUID(name string, _ *uuid.UUID) { d.add(name, KindUUID) }
+func (d *describer) Str(name string, _ *string)     { d.add(name, KindStr) }
+func (d *describer) Tail(name string, _ *string)    { d.add(name, KindTail) }
+
+func (d *describer) List(name string, _ int, item func(v Visitor, i int)) {
+	// Same as decoding the first item, so the message grows a zero-valued item for us
+	var elem describer
+	item(&elem, 0)
+	d.fields = append(d.fields, Field{Name: name, Kind: KindList, Fields: elem.fields})
+}
@@ -0,0 +1,230 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/wire"
+)
+
+// This file implements encoding and decoding messages using nothing but a Schema, which
+// is how the Go encoders of games get checked against their schemas. Game messages are
+// always in the schema's Version of the binary encoding because games encode their own
+// messages.
+
+// DecodeState decodes a state message body (everything after the scope byte) according
+// to the schema. The result is an object just like the ones the generated TypeScript
+// decoders return, i.e., it has a "type" key with the message name, plus one key for
+// each field.
+func (s *Schema) DecodeState(body []byte) (map[string]any, error) {
+	return decodeWithSchema(s.States, s.Version, body)
+}
+
+// DecodeRequest is just like DecodeState, but for requests.
+func (s *Schema) DecodeRequest(body []byte) (map[string]any, error) {
+	return decodeWithSchema(s.Requests, s.Version, body)
+}
+
+func decodeWithSchema(msgs []MessageSchema, v Version, body []byte) (map[string]any, error) {
+	if len(body) == 0 {
+		return nil, wire.ErrTruncated
+	}
+
+	for _, ms := range msgs {
+		if ms.Type != body[0] {
+			continue
+		}
+
+		r := newReader(body[1:], v)
+		obj := make(map[string]any, 1+len(ms.Fields))
+		obj["type"] = ms.Name
+
+		for _, f := range ms.Fields {
+			obj[f.Name] = decodeField(&r, &f)
+		}
+
+		if err := r.Done(); err != nil {
+			return nil, fmt.Errorf("%s: %w", ms.Name, err)
+		}
+		return obj, nil
+	}
+
+	return nil, fmt.Errorf("protocol: unknown message type %d", body[0])
+}
+
+// decodeField decodes a single binary field, recording any error in the reader.
+func decodeField(r *wire.Reader, f *Field) any {
+	switch f.Kind {
+	case KindU8:
+		return r.U8()
+	case KindU16:
+		return r.U16()
+	case KindU32:
+		return r.U32()
+	case KindU64:
+		return r.U64()
+	case KindBoolean:
+		return r.Bool()
+	case KindUUID:
+		return r.UUID()
+	case KindStr:
+		return r.Str()
+	case KindTail:
+		return string(r.Tail())
+	case KindArray:
+		if f.Elem == nil {
+			r.Fail(fmt.Errorf("protocol: field %q does not describe its elements", f.Name))
+			return nil
+		}
+		elems := make([]any, f.Count)
+		for i := range elems {
+			elems[i] = decodeField(r, f.Elem)
+		}
+		return elems
+	case KindList:
+		var items []any
+		for r.Err() == nil && r.Len() > 0 {
+			item := make(map[string]any, len(f.Fields))
+			for i := range f.Fields {
+				item[f.Fields[i].Name] = decodeField(r, &f.Fields[i])
+			}
+			items = append(items, item)
+		}
+		return items
+	case KindJSON:
+		b := r.Tail()
+		if r.Err() != nil {
+			return nil
+		}
+
+		var v any
+		if err := json.Unmarshal(b, &v); err != nil {
+			r.Fail(fmt.Errorf("protocol: field %q: %w", f.Name, err))
+			return nil
+		}
+		if f.Elem == nil {
+			r.Fail(fmt.Errorf("protocol: field %q does not describe its JSON", f.Name))
+			return nil
+		}
+		if err := checkJSON(f.Elem, v, f.Name); err != nil {
+			r.Fail(err)
+			return nil
+		}
+		return v
+	}
+
+	r.Fail(fmt.Errorf("protocol: field %q has kind %q, which is not allowed in binary messages", f.Name, f.Kind))
+	return nil
+}
+
+// checkJSON makes sure a value decoded by encoding/json matches its description, down to
+// the exact set of keys for objects.
+func checkJSON(f *Field, v any, path string) error {
+	var ok bool
+
+	switch f.Kind {
+	case KindNumber:
+		_, ok = v.(float64)
+	case KindString:
+		_, ok = v.(string)
+	case KindBoolean:
+		_, ok = v.(bool)
+	case KindArray, KindRecord:
+		if f.Elem == nil {
+			return fmt.Errorf("protocol: %s does not describe its elements", path)
+		}
+		if arr, isArr := v.([]any); isArr && f.Kind == KindArray {
+			for i, elem := range arr {
+				if err := checkJSON(f.Elem, elem, path+"["+strconv.Itoa(i)+"]"); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if obj, isObj := v.(map[string]any); isObj && f.Kind == KindRecord {
+			for key, elem := range obj {
+				if err := checkJSON(f.Elem, elem, path+"."+key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case KindObject:
+		obj, isObj := v.(map[string]any)
+		if !isObj {
+			break
+		}
+		if len(obj) != len(f.Fields) {
+			return fmt.Errorf("protocol: %s has %d keys but %d are described", path, len(obj), len(f.Fields))
+		}
+		for i := range f.Fields {
+			key := f.Fields[i].Name
+			elem, found := obj[key]
+			if !found {
+				return fmt.Errorf("protocol: %s is missing key %q", path, key)
+			}
+			if err := checkJSON(&f.Fields[i], elem, path+"."+key); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("protocol: %s has unknown kind %q", path, f.Kind)
+	}
+
+	if !ok {
+		return fmt.Errorf("protocol: %s should be %s but is %T", path, f.Kind, v)
+	}
+	return nil
+}
+
+// SampleRequest encodes a request with made-up field values, returning both the binary
+// body (everything after the scope byte) and the JSON form, like the generated TypeScript
+// encoders take. Every field gets a different value so that mixed-up fields can be told
+// apart.
+func (s *Schema) SampleRequest(ms MessageSchema) (body []byte, jsonForm []byte, err error) {
+	w := newWriter([]byte{ms.Type}, s.Version)
+	obj := map[string]any{"type": ms.Name}
+	next := uint32(1)
+
+	for _, f := range ms.Fields {
+		switch f.Kind {
+		case KindU8:
+			w.U8(uint8(next))
+			obj[f.Name] = uint8(next)
+		case KindU16:
+			w.U16(uint16(next))
+			obj[f.Name] = uint16(next)
+		case KindU32:
+			w.U32(next)
+			obj[f.Name] = next
+		case KindU64:
+			w.U64(uint64(next))
+			obj[f.Name] = uint64(next)
+		case KindBoolean:
+			w.Bool(next%2 == 1)
+			obj[f.Name] = next%2 == 1
+		case KindUUID:
+			v := uuid.UUID{15: byte(next)}
+			w.UUID(v)
+			obj[f.Name] = v
+		case KindStr, KindTail:
+			v := "sample" + strconv.Itoa(int(next))
+			if f.Kind == KindStr {
+				w.Str(v)
+			} else {
+				w.RawStr(v)
+			}
+			obj[f.Name] = v
+		default:
+			return nil, nil, errors.New("protocol: cannot make up a value for a " + string(f.Kind))
+		}
+		next++
+	}
+
+	jsonForm, err = json.Marshal(obj)
+	return w.Bytes(), jsonForm, err
+}
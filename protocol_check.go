@@ -0,0 +1,163 @@
+package games
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// checkPlayers is how many fake players CheckProtocol runs a game with.
+const checkPlayers = 4
+
+// CheckProtocol makes sure a game's Protocol description agrees with its Go code. It runs
+// an instance of the game with some fake players, who join and then make every described
+// request with made-up arguments, then leave and come back, and returns an error if:
+//
+//   - the game sends a state message which does not decode according to the description
+//   - a described state message never gets sent (the game must send all of them in
+//     response to new players or the made-up requests)
+//   - for a JSONGame, the JSON form of a described request does not convert to the
+//     binary form, or a state message does not convert to JSON with the right "type"
+//
+// This is what `go run ./cmd/protogen -check` uses, so a game's description should be
+// fixed (or the game) whenever it returns an error.
+func CheckProtocol(g DescribedGame) error {
+	schema := g.Protocol()
+	if schema.Name != g.ID() {
+		return fmt.Errorf("%s: protocol is named %q", g.ID(), schema.Name)
+	}
+
+	jsonGame, _ := g.(JSONGame)
+
+	r := &room{
+		slowClients: SlowClientPolicy{MaxQueued: math.MaxInt32},
+		chat:        newChatBuffer(defaultChatHistory),
+		metrics:     &metrics{},
+	}
+	players := make([]*Client, checkPlayers)
+	for i := range players {
+		players[i] = &Client{
+			ID:    uuid.New(),
+			Name:  "player " + strconv.Itoa(i+1),
+			room:  r,
+			queue: newSendQueue(),
+			// Otherwise broadcasts only come with a prepared frame, not the message
+			sequenced: true,
+		}
+	}
+
+	seen := make(map[string]bool, len(schema.States))
+
+	// checkSent goes over every message sent to the players since it was last called
+	checkSent := func() error {
+		for _, c := range players {
+			msgs, _, _ := c.queue.take(nil)
+
+			for _, out := range msgs {
+				if len(out.msg) > 0 && out.msg[0] == scopeRoom {
+					continue // narration, which goes through the room's chat
+				}
+				if len(out.msg) == 0 || out.msg[0] != scopeGame {
+					return fmt.Errorf("%s: sent a message without the game scope", g.ID())
+				}
+
+				body := out.msg[1:]
+				obj, err := schema.DecodeState(body)
+				if err != nil {
+					return fmt.Errorf("%s: %w", g.ID(), err)
+				}
+
+				name := obj["type"].(string)
+				seen[name] = true
+
+				if jsonGame != nil {
+					if err := checkStateJSON(jsonGame, body, name); err != nil {
+						return fmt.Errorf("%s: %s: %w", g.ID(), name, err)
+					}
+				}
+			}
+		}
+		return nil
+	}
+
+	state := g.NewInstance()
+	r.currentGame = state
+	state.Init(Room{r, r.gameGen}, nil)
+
+	for _, c := range players {
+		state.HandleNewPlayer(c)
+		if err := checkSent(); err != nil {
+			return err
+		}
+	}
+
+	for _, ms := range schema.Requests {
+		body, jsonForm, err := schema.SampleRequest(ms)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", g.ID(), ms.Name, err)
+		}
+
+		if jsonGame != nil {
+			converted, err := jsonGame.RequestFromJSON(jsonForm)
+			if err != nil {
+				return fmt.Errorf("%s: %s: converting %s: %w", g.ID(), ms.Name, jsonForm, err)
+			}
+			if !bytes.Equal(converted, body) {
+				return fmt.Errorf("%s: %s: %s converts to %v, should be %v", g.ID(), ms.Name, jsonForm, converted, body)
+			}
+		}
+
+		for _, c := range players {
+			state.HandleRequest(players, c, body)
+			if err := checkSent(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, c := range players {
+		state.HandlePlayerLeft(players[i+1:], c)
+		if err := checkSent(); err != nil {
+			return err
+		}
+	}
+	for i, c := range players {
+		state.HandleNewPlayer(c)
+		state.HandlePlayerRejoined(players[:i+1], c)
+		if err := checkSent(); err != nil {
+			return err
+		}
+	}
+
+	state.Deinit()
+
+	for _, ms := range schema.States {
+		if !seen[ms.Name] {
+			return fmt.Errorf("%s: never sent state message %q", g.ID(), ms.Name)
+		}
+	}
+
+	return nil
+}
+
+func checkStateJSON(g JSONGame, body []byte, name string) error {
+	data := g.StateJSON(body)
+	if data == nil {
+		return nil // passed through as base64, which is always fine
+	}
+
+	var obj struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("invalid JSON form: %w", err)
+	}
+	if obj.Type != name {
+		return fmt.Errorf("JSON form has type %q", obj.Type)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package games_test
+
+import (
+	"testing"
+
+	"github.com/samclaus/games"
+	"github.com/samclaus/games/bravewength"
+	"github.com/samclaus/games/protocol"
+	"github.com/samclaus/games/skull"
+)
+
+// These are the same checks as `go run ./cmd/protogen -check`, so that the protocol
+// descriptions can't drift away from the Go code without failing the tests.
+
+func TestRoomSchema(t *testing.T) {
+	if err := protocol.CheckRoomSchema(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGameProtocols(t *testing.T) {
+	tests := []struct {
+		name string
+		game games.Game
+	}{
+		{"bravewength", bravewength.Game(nil)},
+		{"skull", skull.Game()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, ok := tt.game.(games.DescribedGame)
+			if !ok {
+				t.Fatalf("%s does not describe its protocol", tt.name)
+			}
+			if err := games.CheckProtocol(g); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
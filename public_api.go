@@ -1,14 +1,18 @@
 package games
 
 import (
+	"compress/flate"
+	"context"
 	"net/http"
 
 	"github.com/gorilla/websocket"
+	"github.com/samclaus/games/protocol"
 )
 
 type Server interface {
 	HandleGetRooms(http.ResponseWriter, *http.Request)
 	HandleJoinRoom(http.ResponseWriter, *http.Request)
+	HandleMetrics(http.ResponseWriter, *http.Request)
 }
 
 // GameState is the interface implemented by individual game instances. Each
@@ -17,9 +21,10 @@ type Server interface {
 // called in the same goroutine that created the instance via Game.NewInstance().
 type GameState interface {
 	// Init is a hook allowing the game to broadcast initial state to players as
-	// necessary. Client references are NOT safe to retain and use after this
-	// method returns!
-	Init(players []*Client)
+	// necessary. The room handle lets the game end itself, post system messages,
+	// and so on, and is safe to retain until Deinit is called. Client references
+	// are NOT safe to retain and use after this method returns!
+	Init(room Room, players []*Client)
 	// HandleRequest is a hook allowing the game to act on a request made by a
 	// player. Client references are NOT safe to retain and use after this
 	// method returns!
@@ -28,6 +33,17 @@ type GameState interface {
 	// new player that has just joined the room. The client reference is NOT safe
 	// to retain and use after this method returns!
 	HandleNewPlayer(player *Client)
+	// HandlePlayerLeft is a hook allowing the game to forget about a member who
+	// left the room for good (members whose connection dies may come back for a
+	// little while before that happens), e.g., by skipping their turns. The players
+	// no longer include them. Client references are NOT safe to retain and use
+	// after this method returns!
+	HandlePlayerLeft(players []*Client, player *Client)
+	// HandlePlayerRejoined is a hook allowing the game to take back a player who
+	// left during the game and has now joined the room again, with the same ID. It
+	// is called right after HandleNewPlayer. Client references are NOT safe to
+	// retain and use after this method returns!
+	HandlePlayerRejoined(players []*Client, player *Client)
 	// Deinit is a hook allowing the game to clean up its memory and help out
 	// the garbage collector.
 	Deinit()
@@ -59,6 +75,115 @@ type Game interface {
 	NewInstance() GameState
 }
 
+// JSONGame is an optional interface for Game implementations whose game-scope messages
+// have a natural JSON form. For clients using the JSON encoding (see the protocol
+// package), game-scope messages of games that don't implement it are passed through
+// as base64. Like every Game method, these MUST be safe to call from multiple
+// goroutines without additional synchronization.
+type JSONGame interface {
+	Game
+	// StateJSON converts the body of a game-scope state message (everything after the
+	// header byte added by AllocGameMessage) to JSON. Returning nil means the message
+	// has no JSON form, and it will be passed through as base64 instead.
+	StateJSON(body []byte) []byte
+	// RequestFromJSON converts the JSON form of a game-scope request into the body
+	// GameState.HandleRequest expects.
+	RequestFromJSON(data []byte) ([]byte, error)
+}
+
+// DescribedGame is an optional interface for Game implementations which describe their
+// game-scope messages in a machine-readable way, so that client code can be generated
+// for them (see cmd/protogen). CheckProtocol makes sure the description is accurate.
+type DescribedGame interface {
+	Game
+	// Protocol describes every game-scope state message and request. The name of the
+	// schema must be the game ID.
+	Protocol() protocol.Schema
+}
+
+// ChatChannels is an optional interface for GameState implementations which want chat
+// channels besides the room's global one, such as one for each team, or which need to
+// stop some players from messaging each other directly. The room asks whenever someone
+// posts, when the game is booted, and when a new player joins; if the answers change
+// for any other reason (e.g., a player switched teams), the game must call
+// RefreshChatChannels.
+type ChatChannels interface {
+	// ChatChannels returns the channels defined by the game which the player can see,
+	// and whether they may post to each one. Channel IDs must not be empty or start
+	// with protocol.DirectChannelPrefix. The client reference is NOT safe to retain
+	// and use after this method returns!
+	ChatChannels(player *Client) []protocol.Channel
+	// CanMessageDirectly reports whether one player may send a direct message to
+	// another. The client references are NOT safe to retain and use after this method
+	// returns!
+	CanMessageDirectly(from, to *Client) bool
+}
+
+// ChatCommands is an optional interface for GameState implementations which add their
+// own slash commands to chat, like /score. Messages posted to the global channel or one
+// of the game's channels which start with a slash are run as commands instead of being
+// posted. The room's built-in commands (/roll, /flip, /name, /kick, and /help) take
+// precedence over game commands with the same name.
+type ChatCommands interface {
+	// ChatCommands returns the commands the game currently offers.
+	ChatCommands() []ChatCommand
+}
+
+// ChatCommand is a slash command, built into the room or added by a game.
+type ChatCommand struct {
+	// Name is what players type after the slash, in lowercase, e.g., "score".
+	Name string
+	// Args describes the command's arguments for /help, e.g., "<name>"; empty if it
+	// takes none.
+	Args string
+	// Help is a short description of the command for /help.
+	Help string
+	// Run runs the command, with the rest of the message split into words. Each line of
+	// the result is posted as a system message in the channel the command was sent to,
+	// and so is the error, if any; an empty result posts nothing. Lines longer than 100
+	// bytes are cut short. Client references are NOT safe to retain and use after this
+	// function returns!
+	Run func(players []*Client, src *Client, args []string) (string, error)
+}
+
+// Pausable is an optional interface for GameState implementations which want to know
+// when the game is paused or resumed (see Room.After for timers, which stop on their
+// own). The room ignores game-scope requests while the game is paused, but the other
+// hooks are still called, e.g., when a player joins.
+type Pausable interface {
+	// HandlePause is called right after the game is paused. Client references are NOT
+	// safe to retain and use after this method returns!
+	HandlePause(players []*Client)
+	// HandleResume is called right after the game is resumed. Client references are
+	// NOT safe to retain and use after this method returns!
+	HandleResume(players []*Client)
+}
+
+// Undoable is an optional interface for GameState implementations which can take back
+// moves, e.g., after a misclick. The game saves a checkpoint after each request it
+// accepts (see Router.OnAccept and Checkpoints), and the room asks it to go back to the
+// previous one when the host, or a majority of members, ask to undo. Games shouldn't
+// undo past the end of a game, since its result has already been announced.
+type Undoable interface {
+	// CanUndo returns true if there is a checkpoint to go back to.
+	CanUndo() bool
+	// Undo rolls the game back to the previous checkpoint, and must broadcast whatever
+	// state changed. Client references are NOT safe to retain and use after this method
+	// returns!
+	Undo(players []*Client)
+}
+
+// ChatFilter screens chat messages posted by members before they are added to a
+// channel, e.g., to keep out offensive words. It is shared by every room, so it MUST be
+// safe to call from multiple goroutines without additional synchronization.
+type ChatFilter interface {
+	// FilterChat returns the message as it should be posted, which may be changed
+	// (like masking some words), or ok == false to reject it. The channel is
+	// protocol.GlobalChannel, a channel defined by the current game, or a direct
+	// message channel.
+	FilterChat(channel, content string) (filtered string, ok bool)
+}
+
 // AllocGameMessage allocates a byte slice with a 1-byte header to tell
 // client-side code that the remainder of the WebSocket message is only to
 // be interpreted by the current game's client-side code. The slice is
@@ -67,15 +192,107 @@ func AllocGameMessage(cap int) []byte {
 	return append(make([]byte, 0, 1+cap), scopeGame)
 }
 
+// SlowClientPolicy decides when a client is too slow to keep up with the messages
+// being sent to it. Once a client crosses either limit, it is kicked from the room
+// and sent a close frame explaining why. Snapshots that get replaced by newer
+// snapshots before being written (see Client.SendSnapshot) do not count.
+type SlowClientPolicy struct {
+	// MaxQueued is how many messages may be waiting to be written to a client.
+	// Defaults to 100 if zero.
+	MaxQueued int
+	// MaxQueuedBytes is how many bytes may be waiting to be written to a client.
+	// Zero means no limit.
+	MaxQueuedBytes int
+}
+
+func (p SlowClientPolicy) tooSlow(queued, queuedBytes int) bool {
+	return queued > p.MaxQueued || (p.MaxQueuedBytes > 0 && queuedBytes > p.MaxQueuedBytes)
+}
+
+// ServerConfig holds everything needed to create a server with NewServerWithConfig().
+// The zero value of each field is a sensible default, except that a server without
+// any games is not much use.
+type ServerConfig struct {
+	// Context, if non-nil, controls the lifetime of the server. Once it is canceled,
+	// every room disconnects its members and shuts down.
+	Context     context.Context
+	Upgrader    websocket.Upgrader
+	Games       []Game
+	SlowClients SlowClientPolicy
+	Compression CompressionConfig
+	// ChatHistory is how many messages each chat channel remembers, which members can
+	// page back through. Defaults to 1000 if zero.
+	ChatHistory int
+	// ChatFilter gets a say in every chat message posted by a member. Defaults to a
+	// WordListFilter masking a short list of slurs and swear words if nil; use
+	// NoChatFilter to let everything through.
+	ChatFilter ChatFilter
+	// OnGameEvent, if non-nil, is called with every event games report with Room.Emit,
+	// e.g., to keep a leaderboard. It is called from the goroutine of the room the
+	// game is running in, so it MUST be safe to call from multiple goroutines and
+	// should return quickly.
+	OnGameEvent func(GameEvent)
+}
+
+// NewServer creates a server with the given games and the default value for every
+// other setting in ServerConfig.
 func NewServer(u websocket.Upgrader, games ...Game) Server {
+	return NewServerWithConfig(ServerConfig{
+		Upgrader: u,
+		Games:    games,
+	})
+}
+
+func NewServerWithConfig(cfg ServerConfig) Server {
 	gamesByID := make(map[string]Game)
-	for _, g := range games {
+	for _, g := range cfg.Games {
 		gamesByID[g.ID()] = g
 	}
 
+	if cfg.Context == nil {
+		cfg.Context = context.Background()
+	}
+	if cfg.SlowClients.MaxQueued <= 0 {
+		cfg.SlowClients.MaxQueued = 100
+	}
+	if cfg.ChatHistory <= 0 {
+		cfg.ChatHistory = defaultChatHistory
+	}
+	if cfg.ChatFilter == nil {
+		cfg.ChatFilter = NewWordListFilter(defaultWords, false)
+	}
+	// Copy the level so the caller can't change it out from under us
+	level := flate.BestSpeed
+	if cfg.Compression.Level != nil {
+		level = *cfg.Compression.Level
+	}
+	cfg.Compression.Level = &level
+	if cfg.Compression.MinSize == 0 {
+		cfg.Compression.MinSize = 256
+	} else if cfg.Compression.MinSize < 0 {
+		cfg.Compression.MinSize = 0
+	}
+	cfg.Upgrader.EnableCompression = cfg.Compression.Enabled
+
+	// Copy so we don't modify the caller's slice. The upgrader goes with the first of
+	// these that the client offers, so newer versions go first.
+	cfg.Upgrader.Subprotocols = append(
+		cfg.Upgrader.Subprotocols[:len(cfg.Upgrader.Subprotocols):len(cfg.Upgrader.Subprotocols)],
+		protocol.SubprotocolBinaryV2,
+		protocol.SubprotocolBinary,
+		protocol.SubprotocolJSON,
+	)
+
 	return &server{
-		upgrader: u,
-		games:    gamesByID,
-		rooms:    make(map[uint32]*room),
+		ctx:         cfg.Context,
+		upgrader:    cfg.Upgrader,
+		games:       gamesByID,
+		slowClients: cfg.SlowClients,
+		compression: cfg.Compression,
+		chatFilter:  cfg.ChatFilter,
+		chatHistory: cfg.ChatHistory,
+		onGameEvent: cfg.OnGameEvent,
+		metrics:     &metrics{},
+		rooms:       make(map[uint32]*room),
 	}
 }
@@ -1,64 +1,128 @@
 package games
 
-const (
-	reqBootGame byte = iota
-	reqKillGame
-	reqMessageChat
+import (
+	"github.com/samclaus/games/protocol"
 )
 
 // handleRequest should only ever be called by the room's event-processing goroutine;
-// it will branch based on the request type, decide whether the given client is allowed
-// to make the request (also depending on the current room state), and will then update
-// room state and emit an event to all connected clients accordingly.
+// it will decode the request, forwarding it to the current game if it is game-scope,
+// and otherwise pass it along to handleRoomRequest().
 //
-// Invalid requests are simply ignored, without sending error feedback to the client.
-// Please see decodeRequest() for my explanation of why.
+// Requests that can't even be decoded get the client kicked, because the client is
+// clearly not speaking the same protocol as us.
 func (r *room) handleRequest(req request) {
-	// TODO: disconnect any client that sends an invalid request structure?
+	var body []byte
+
+	if req.text {
+		jm, err := protocol.DecodeJSONRequest(req.msg)
+		if err != nil {
+			r.debug("Invalid JSON request from %q: %v", req.src.Name, err)
+			r.evict(req.src, closeProtocolViolation)
+			return
+		}
+
+		if jm.Scope == protocol.ScopeRoom {
+			r.handleRoomRequest(req.src, jm.Message)
+			return
+		}
+
+		if body, err = r.gameRequestFromJSON(req.src, jm); err != nil {
+			r.debug("Invalid JSON game request from %q: %v", req.src.Name, err)
+			return
+		}
+	} else {
+		if len(req.msg) < 2 || req.msg[0] > scopeGame {
+			r.evict(req.src, closeProtocolViolation)
+			return
+		}
+
+		if req.msg[0] == scopeRoom {
+			m, err := protocol.DecodeBinaryRequest(req.src.enc.version(), req.msg)
+			if err != nil {
+				// Might just be a newer client talking to an older server, so this is
+				// not worth kicking them over
+				r.debug("Invalid request from %q: %v", req.src.Name, err)
+				return
+			}
+
+			r.handleRoomRequest(req.src, m)
+			return
+		}
+
+		body = req.msg[1:]
+	}
 
-	if len(req.msg) < 2 || req.msg[0] > scopeGame {
+	if r.currentGame == nil {
 		return
 	}
-	if req.msg[0] == scopeGame {
-		if r.currentGame != nil {
-			r.currentGame.HandleRequest(r.members, req.src, req.msg[1:])
-		}
+	if r.paused {
+		r.debug("Ignoring game request from %q while the game is paused", req.src.Name)
 		return
 	}
 
-	body := req.msg[2:]
+	r.callGame("HandleRequest", req.src, body, func() {
+		r.currentGame.HandleRequest(r.members, req.src, body)
+	})
+}
 
-	switch req.msg[1] {
-	case reqBootGame:
-		if r.currentGame != nil || len(body) == 0 {
+// handleRoomRequest branches based on the request type, decides whether the given
+// client is allowed to make the request (also depending on the current room state),
+// and will then update room state and emit an event to all connected clients
+// accordingly.
+//
+// Invalid requests are simply ignored, without sending error feedback to the client.
+func (r *room) handleRoomRequest(src *Client, m protocol.Message) {
+	switch m := m.(type) {
+	case *protocol.BootGameRequest:
+		if r.currentGame != nil || m.GameID == "" {
 			return
 		}
 
-		// TODO: can we just use bytes directly? Should consider places where
-		// allocations can be avoided
-		gameID := string(body)
-
-		if factory := r.gameRegistry[gameID]; factory != nil {
-			r.currentGameID = gameID
-			r.broadcast(encodeSetGameState(gameID))
-			r.currentGame = factory.NewInstance()
-			r.currentGame.Init(r.members)
+		if factory := r.gameRegistry[m.GameID]; factory != nil {
+			r.bootGame(m.GameID, factory)
+			r.postNote(protocol.ChatSystem, src.ID, src.Name+" booted "+m.GameID)
 		}
 
-	case reqKillGame:
+	case *protocol.KillGameRequest:
 		if r.currentGame == nil {
 			return
 		}
 
-		r.currentGame.Deinit()
-		r.currentGameID = ""
-		r.currentGame = nil
-		r.broadcast(encodeSetGameState(""))
+		r.postNote(protocol.ChatSystem, src.ID, src.Name+" killed "+r.currentGameID)
+		r.killGame()
 
-	case reqMessageChat:
-		if r.chat.addMessage(req.src.ID, body) {
-			r.broadcast(encodeNewChatMessageState(req.src.ID, body))
-		}
+	case *protocol.MessageChatRequest:
+		r.postToGlobal(src, m.Content)
+
+	case *protocol.MessageChannelRequest:
+		r.postToChannel(src, m.Channel, m.Content)
+
+	case *protocol.MessageDirectRequest:
+		r.postDirect(src, m.To, m.Content)
+
+	case *protocol.SetModeratorRequest:
+		r.setModerator(src, m)
+
+	case *protocol.MuteMemberRequest:
+		r.muteMember(src, m)
+
+	case *protocol.DeleteChatMessageRequest:
+		r.deleteChatMessage(src, m)
+
+	case *protocol.OlderChatMessagesRequest:
+		r.sendOlderMessages(src, m)
+
+	case *protocol.ToggleReactionRequest:
+		r.toggleReaction(src, m)
+
+	case *protocol.PauseGameRequest:
+		r.votePause(src, true)
+
+	case *protocol.ResumeGameRequest:
+		r.votePause(src, false)
+
+	case *protocol.UndoRequest:
+		r.voteUndo(src)
 
 	}
 }
@@ -1,20 +1,42 @@
 package games
 
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/protocol"
+)
+
 // TODO: give credit in README for excellent WebSocket examples in github.com/gorilla/websocket
 // which basically spelled out efficient room/client implementation.
 
 const (
-	// scopeRoom means a request/event is intended for the room itself, not whatever
-	// game (if any) is in progress.
-	scopeRoom byte = iota
-	// scopeGame means a request/event is intended for the current game.
-	scopeGame
+	scopeRoom = protocol.ScopeRoom
+	scopeGame = protocol.ScopeGame
+)
+
+// roomState is where a room is in its lifecycle. Rooms only ever move forward through
+// the states.
+type roomState int32
+
+const (
+	// roomOpen means the room goroutine is processing events and new members can join.
+	roomOpen roomState = iota
+	// roomClosing means the room goroutine has stopped processing events because the
+	// room is empty or the server is shutting down, but has not finished cleaning up.
+	roomClosing
+	// roomClosed means the room is gone from the server and its context is canceled,
+	// so anything trying to hand it a client or request will give up immediately.
+	roomClosed
 )
 
 // request contains a request payload and the client it originated from.
 type request struct {
-	src *Client
-	msg []byte
+	src  *Client
+	msg  []byte
+	text bool // true if the request came in a text frame, i.e., is JSON
 }
 
 // room represents a room which may be (1) pending, meaning the game has not started
@@ -28,9 +50,21 @@ type request struct {
 // locked to the same role so that someone can't, for example, start as a knower and
 // then reconnect as a seeker to cheat.
 //
-// A room will be cleaned up as soon as every member disconnects from it.
+// A room will be cleaned up as soon as every member disconnects from it (or their
+// grace period for resuming expires), or when the server's context is canceled.
 type room struct {
 	gameRegistry map[string]Game
+	slowClients  SlowClientPolicy
+	chatFilter   ChatFilter
+	chatHistory  int
+	onGameEvent  func(GameEvent)
+	metrics      *metrics
+
+	// ctx is canceled once the room is closed, to unblock any goroutine trying to send
+	// to the room's channels; state is a roomState and is safe to read from any goroutine
+	ctx    context.Context
+	cancel context.CancelFunc
+	state  atomic.Int32
 
 	ID   uint32
 	Name string
@@ -47,35 +81,163 @@ type room struct {
 	// are rejected) in each client's read goroutine so that the work can be done in parallel
 	requests chan request
 
-	// Room-global chat for members
-	chat *chatBuffer
+	// Members that need to be removed once the current event is done being processed,
+	// because removing them immediately would mess up any loops over the members slice
+	evictions []eviction
+
+	// Room-global chat for members, and the chat channels defined by the current game
+	// or for direct messages (see chat_channels.go), keyed by channel ID
+	chat     *chatBuffer
+	channels map[string]*chatBuffer
+
+	// The member who created the room (or took over after they left), the members they
+	// made moderators, and when each muted member may chat again (see moderation.go)
+	host       uuid.UUID
+	moderators map[uuid.UUID]bool
+	mutes      map[uuid.UUID]time.Time
 
 	// The in-progress game, which may be nil if a game is not in-progress
 	currentGameID string
 	currentGame   GameState
+
+	// gameGen counts the games booted in the room, so that a game's Room handle stops
+	// working once it is gone, and gameAction is what the game asked the room to do to
+	// it once the current event is done being processed (see room_handle.go)
+	gameGen    uint64
+	gameAction gameAction
+
+	// departed holds the IDs of members who left during the current game, so the game
+	// can be told if they come back
+	departed map[uuid.UUID]bool
+
+	// Whether the current game is paused, who paused it, and who voted to pause it (or
+	// resume it, if it is paused); see pause.go
+	paused     bool
+	pausedBy   uuid.UUID
+	pauseVotes map[uuid.UUID]bool
+
+	// Who voted to undo the last move in the current game (see undo.go)
+	undoVotes map[uuid.UUID]bool
+
+	// Timers set by the current game with Room.After, and the timer for whichever one
+	// fires first, which is nil while there are none or the game is paused (see
+	// game_timers.go)
+	timers []*gameTimer
+	timer  *time.Timer
+	timerC <-chan time.Time
+
+	// The in-progress game's factory if it supports embedding its messages in the JSON
+	// encoding, otherwise nil
+	jsonGame JSONGame
 }
 
-func (r *room) broadcast(msg []byte) {
-	for _, c := range r.members {
-		c.Send(msg)
+// open returns true if the room is still taking new members. Safe to call from any
+// goroutine, but the room could close right after this returns.
+func (r *room) open() bool {
+	return roomState(r.state.Load()) == roomOpen
+}
+
+// join hands a newly-connected client to the room goroutine, returning false if the
+// room closed before it could take them.
+func (r *room) join(c *Client) bool {
+	select {
+	case r.register <- c:
+		return true
+	case <-r.ctx.Done():
+		return false
 	}
 }
 
+// leave tells the room goroutine that the client's connection died, unless the room
+// already closed (in which case the client's queue was already closed).
+func (r *room) leave(c *Client) {
+	select {
+	case r.unregister <- c:
+	case <-r.ctx.Done():
+	}
+}
+
+// submit hands a request to the room goroutine, returning false if the room closed.
+func (r *room) submit(req request) bool {
+	select {
+	case r.requests <- req:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+// eviction is a member waiting to be removed from the room, and the reason why.
+type eviction struct {
+	c      *Client
+	reason closeReason
+}
+
 func (r *room) broadcastAllMembersState() {
-	if len(r.members) > 0 {
-		r.broadcast(encodeSetMembersState(r.members))
+	r.broadcastState(setMembersState(r.members), true)
+}
+
+// postNote appends a system message or game narration to the chat and broadcasts it.
+func (r *room) postNote(kind byte, about uuid.UUID, text string) {
+	r.broadcastState(&protocol.NewChatMessageState{
+		ChatMessage: r.chat.addNote(kind, about, text),
+	}, false)
+}
+
+// postNoteIn is like postNote, but for any channel the room's members can see, and
+// only sends the note to members who can see the channel.
+func (r *room) postNoteIn(channel string, kind byte, about uuid.UUID, text string) {
+	if channel == protocol.GlobalChannel {
+		r.postNote(kind, about, text)
+		return
 	}
+	r.broadcastStateTo(r.channelAudience(channel), &protocol.NewChatMessageState{
+		Channel:     channel,
+		ChatMessage: r.channelBuffer(channel).addNote(kind, about, text),
+	}, false)
 }
 
-func (r *room) removeMember(c *Client) {
-	pos := -1
-	for i := range r.members {
-		if r.members[i] == c {
-			pos = i
-			break
+// evict schedules the client to be removed from the room once the current event is done
+// being processed. Nothing more will be sent to the client other than a close frame for
+// the given reason.
+func (r *room) evict(c *Client, reason closeReason) {
+	for _, e := range r.evictions {
+		if e.c == c {
+			return
 		}
 	}
 
+	c.queue.close(reason.frame())
+	r.evictions = append(r.evictions, eviction{c, reason})
+}
+
+// flushEvictions removes every member passed to evict(). Removing members broadcasts
+// state to the remaining members, which may evict even more of them, so this keeps
+// going until no evictions are left.
+func (r *room) flushEvictions() {
+	for len(r.evictions) > 0 {
+		e := r.evictions[0]
+		r.evictions = r.evictions[1:]
+		r.removeMember(e.c, e.reason)
+	}
+	r.evictions = nil
+}
+
+// settle finishes off the current event by doing whatever the game asked for and
+// removing evicted members. Either one can lead to the other (e.g., a game kicking
+// someone while being told a member left), so this keeps going until both are done.
+func (r *room) settle() {
+	for len(r.evictions) > 0 || r.gameAction != gameActionNone {
+		r.flushGameAction()
+		r.flushEvictions()
+	}
+}
+
+// removeMember removes the client from the room, sending them a close frame for the
+// given reason if their connection is still alive. MUST NOT be called while looping
+// over the members slice; use evict() instead.
+func (r *room) removeMember(c *Client, reason closeReason) {
+	pos := r.memberIndex(c)
 	if pos < 0 {
 		return
 	}
@@ -87,60 +249,239 @@ func (r *room) removeMember(c *Client) {
 		r.members = r.members[:lastIndex]
 	}
 
-	// IMPORTANT: attempting to close an already-closed channel
-	// causes Go to panic. removeMember() might be called twice,
-	// so it should only close the Send channel the first time
-	// when it actually removes the client.
+	// NOTE: closing the queue is a no-op if it is already closed,
+	// which is the case for detached members
 	//
 	// TODO: cleaner way to handle the whole dance between
 	// client read/write goroutines and the room goroutine?
-	close(c.send)
+	c.queue.close(reason.frame())
+
+	// The same person can be connected more than once (e.g., two browser tabs), and
+	// they haven't left until their last connection is gone
+	if r.member(c.ID) != nil {
+		r.debug("Unregistered extra connection of client [ID: %s, Name: %q]", c.ID.String(), c.Name)
+		return
+	}
 
-	r.broadcast(encodeDeleteMemberState(c.ID))
+	r.broadcastState(&protocol.DeleteMembersState{IDs: []uuid.UUID{c.ID}}, false)
 	r.debug("Unregistered client [ID: %s, Name: %q]", c.ID.String(), c.Name)
+	r.dropDirectChannels(c)
+	r.forgetModerator(c)
+	r.forgetPauseVote(c)
+	r.forgetUndoVote(c)
+	r.postNote(protocol.ChatSystem, c.ID, c.Name+" left")
+
+	if r.currentGame != nil {
+		if r.departed == nil {
+			r.departed = make(map[uuid.UUID]bool)
+		}
+		r.departed[c.ID] = true
+		r.callGame("HandlePlayerLeft", c, nil, func() {
+			r.currentGame.HandlePlayerLeft(r.members, c)
+		})
+	}
 }
 
-// processEvents should be started in a new goroutine as soon as a room is created. This
-// function will continually process client requests and broadcasting state until the room
-// is closed (when the last client disconnects).
-func (r *room) processEventsUntilClosed() {
-	r.debug("Room created")
-	defer r.debug("Room destroyed")
+func (r *room) memberIndex(c *Client) int {
+	for i, m := range r.members {
+		if m == c {
+			return i
+		}
+	}
+	return -1
+}
 
-	for {
-		select {
-		case c := <-r.register:
-			r.debug("Registering client [ID: %s, Name: %q]", c.ID.String(), c.Name)
+// detachMember keeps a sequenced member in the room after their connection dies so
+// they can resume their session, closing their send queue so the write goroutine
+// exits. Messages sent to them in the meantime only go to their replay buffer.
+func (r *room) detachMember(c *Client) {
+	c.queue.close(closeNone.frame())
+	c.session.detachedAt = time.Now()
+	r.debug("Detached client [ID: %s, Name: %q]", c.ID.String(), c.Name)
+}
+
+// evictExpiredMembers evicts detached members whose grace period is over.
+func (r *room) evictExpiredMembers() {
+	for _, c := range r.members {
+		if c.session != nil && c.session.detached() &&
+			time.Since(c.session.detachedAt) > resumeGracePeriod {
+			r.evict(c, closeNone)
+		}
+	}
+}
+
+// sendFullState sends everything a client needs to build its view of the room from
+// scratch, except for the member list, which the caller should broadcast.
+func (r *room) sendFullState(c *Client) {
+	r.sendState(c, &protocol.InitState{
+		RoomID:   r.ID,
+		ClientID: c.ID,
+		RoomName: r.Name,
+		GameID:   r.currentGameID,
+	}, false)
+	r.sendState(c, r.moderatorsState(), false)
+	if r.paused || len(r.pauseVotes) > 0 {
+		r.sendState(c, r.pauseState(), false)
+	}
+	if len(r.undoVotes) > 0 {
+		r.sendState(c, r.undoVotesState(), false)
+	}
+	r.sendHistory(c, protocol.GlobalChannel, r.chat)
+	r.sendDirectHistory(c)
+}
 
-			if len(r.members) >= maxRoomMembers {
-				close(c.send)
-				continue
+// resumeMember attempts to swap a new connection in for an existing member with the
+// same ID, replaying whatever messages the client missed. If too many messages were
+// missed, the new connection still takes over the member's spot but gets a full
+// resync instead. Returns false if there is no session to resume.
+func (r *room) resumeMember(c *Client) bool {
+	// The person might have other tabs open, so go for the connection that is actually
+	// dead if there is one
+	pos := -1
+	for i, m := range r.members {
+		if m.ID == c.ID && m.session != nil && (pos < 0 || m.session.detached()) {
+			pos = i
+			if m.session.detached() {
+				break
 			}
+		}
+	}
 
-			// NOTE: this is the first time anything will be pushed on the new client's send
-			// channel, so the '<-' operations below literally cannot fail (channel is buffered)
-			c.send <- encodeInitState(r, c.ID)
-			c.send <- encodeAllChatMessagesState(r.chat)
+	if pos < 0 {
+		return false
+	}
 
-			r.members = append(r.members, c)
-			r.broadcastAllMembersState() // TODO: just set member? still need all members for new client
+	old := r.members[pos]
+	if !old.session.detached() {
+		// The old connection has not noticed it is dead yet; the new one wins
+		old.queue.close(closeReplaced.frame())
+	}
 
-			if r.currentGameID != "" {
-				r.currentGame.HandleNewPlayer(c)
-			}
+	// The name might have been changed with /name since the client connected
+	c.Name = old.Name
+	c.session = old.session
+	c.session.detachedAt = time.Time{}
+	c.channels = old.channels
+	r.members[pos] = c
+
+	// Messages in the replay buffer are in the old connection's encoding
+	if missed, ok := c.session.appendMissed(nil, c.resumeFrom); ok && old.enc == c.enc {
+		r.debug("Resuming client [ID: %s, Name: %q] after %d missed messages", c.ID.String(), c.Name, len(missed))
+
+		for _, out := range missed {
+			c.queue.push(out)
+		}
+	} else {
+		r.debug("Client [ID: %s, Name: %q] missed too much to resume, resyncing", c.ID.String(), c.Name)
+		r.sendFullState(c)
+		r.sendState(c, setMembersState(r.members), true)
+		if r.currentGame != nil {
+			r.callGame("HandleNewPlayer", c, nil, func() { r.currentGame.HandleNewPlayer(c) })
+			r.syncChannels(c, true)
+		}
+	}
+
+	return true
+}
+
+// registerMember adds a newly-connected client to the room, or swaps it in for an
+// existing member if it is resuming their session.
+func (r *room) registerMember(c *Client) {
+	r.debug("Registering client [ID: %s, Name: %q]", c.ID.String(), c.Name)
+
+	if c.resumeFrom > 0 && r.resumeMember(c) {
+		return
+	}
+
+	if len(r.members) >= maxRoomMembers {
+		c.queue.close(closeRoomFull.frame())
+		return
+	}
+
+	if r.host == uuid.Nil {
+		r.host = c.ID
+	}
+
+	r.sendFullState(c)
+
+	// Another connection of somebody who is already here (e.g., a second browser tab)
+	// only needs to catch up, not be announced
+	extra := r.member(c.ID) != nil
+
+	r.members = append(r.members, c)
+	if extra {
+		r.sendState(c, setMembersState(r.members), true)
+	} else {
+		r.broadcastAllMembersState() // TODO: just set member? still need all members for new client
+		r.postNote(protocol.ChatSystem, c.ID, c.Name+" joined")
+	}
+
+	if r.currentGameID != "" {
+		r.callGame("HandleNewPlayer", c, nil, func() { r.currentGame.HandleNewPlayer(c) })
+		if r.departed[c.ID] {
+			delete(r.departed, c.ID)
+			r.callGame("HandlePlayerRejoined", c, nil, func() {
+				r.currentGame.HandlePlayerRejoined(r.members, c)
+			})
+		}
+		r.syncChannels(c, true)
+	}
+}
+
+// unregisterMember handles a client whose connection died, either removing them from
+// the room or, if they might resume their session, detaching them.
+func (r *room) unregisterMember(c *Client) {
+	if c.session != nil && r.memberIndex(c) >= 0 {
+		r.detachMember(c)
+		return
+	}
+
+	r.removeMember(c, closeNone)
+	c.room = nil
+}
+
+// processEventsUntilClosed should be started in a new goroutine as soon as a room is
+// created. This function will continually process client requests and broadcasting
+// state until the room has no members left (when the last client disconnects) or the
+// room's context is canceled, at which point it cleans up the room and returns. The
+// caller is responsible for canceling the context afterwards.
+func (r *room) processEventsUntilClosed() {
+	r.debug("Room created")
+	defer r.debug("Room destroyed")
+
+	sweepTicker := time.NewTicker(sweepInterval)
+	defer sweepTicker.Stop()
+
+	for len(r.members) > 0 {
+		select {
+		case c := <-r.register:
+			r.registerMember(c)
 		case c := <-r.unregister:
-			r.removeMember(c)
-			c.room = nil
-
-			if len(r.members) == 0 {
-				// Last client disconnected so this room needs to get cleaned up
-				r.members = nil
-				close(r.requests)
-				// TODO: more cleanup necessary here?
-				return
-			}
+			r.unregisterMember(c)
+		case <-sweepTicker.C:
+			r.evictExpiredMembers()
+		case <-r.timerC:
+			r.fireTimers()
 		case req := <-r.requests:
 			r.handleRequest(req)
+		case <-r.ctx.Done():
+			r.debug("Shutting down")
+			for _, c := range r.members {
+				r.evict(c, closeShutdown)
+			}
 		}
+
+		r.settle()
 	}
+
+	r.state.Store(int32(roomClosing))
+	r.dropTimers()
+
+	if r.currentGame != nil {
+		r.callGame("Deinit", nil, nil, r.currentGame.Deinit)
+		r.currentGame = nil
+		r.currentGameID = ""
+	}
+
+	r.members = nil
 }
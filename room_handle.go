@@ -0,0 +1,183 @@
+package games
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/samclaus/games/protocol"
+)
+
+// Room is a game's handle on the room it is running in, passed to GameState.Init. It is
+// safe to retain until the game's Deinit is called, but like the rest of GameState, ONLY
+// FROM THE ROOM'S PROCESSING GOROUTINE! Once the game is killed (or replaced by a
+// rematch), every method does nothing, so a game can't affect whatever comes after it.
+type Room struct {
+	r *room
+	// gen is which game booted in the room the handle belongs to
+	gen uint64
+}
+
+// GameEvent is something notable that happened in a game, reported with Room.Emit, like
+// who won.
+type GameEvent struct {
+	RoomID uint32
+	GameID string
+	// Type is up to the game, e.g., "won".
+	Type string
+	// Data is whatever the game wants to report along with the event, which should be
+	// safe to use from other goroutines and encode as JSON.
+	Data any
+	Time time.Time
+}
+
+// gameAction is something a game asked the room to do to it (or, if it panicked, what
+// the room has to do about it), which waits until the current event is done being
+// processed so that the game isn't torn down in the middle of one of its own hooks.
+type gameAction int
+
+const (
+	gameActionNone gameAction = iota
+	gameActionEnd
+	gameActionRematch
+	gameActionCrash
+)
+
+// live returns true if the handle's game is still the room's current game, and has not
+// crashed.
+func (h Room) live() bool {
+	return h.r != nil && h.r.currentGame != nil && h.r.gameGen == h.gen &&
+		h.r.gameAction != gameActionCrash
+}
+
+// EndGame kills the game once the hook calling it returns, just like a member killing
+// it, and posts a system message saying it ended.
+func (h Room) EndGame() {
+	if h.live() {
+		h.r.gameAction = gameActionEnd
+	}
+}
+
+// Rematch replaces the game with a fresh instance of the same game once the hook
+// calling it returns, which gets a new handle in its Init.
+func (h Room) Rematch() {
+	if h.live() {
+		h.r.gameAction = gameActionRematch
+	}
+}
+
+// Announce posts a system message to the room's global chat channel. Unlike Narrate,
+// the message shows up as coming from the room itself, like "bob joined". Messages
+// longer than 100 bytes are cut short.
+func (h Room) Announce(text string) {
+	if h.live() && text != "" {
+		h.r.postNote(protocol.ChatSystem, uuid.Nil, text)
+	}
+}
+
+// Members returns every member of the room, which is the same slice passed to the
+// game's hooks. It must not be modified, and is NOT safe to retain and use after the
+// hook calling this returns!
+func (h Room) Members() []*Client {
+	if !h.live() {
+		return nil
+	}
+	return h.r.members
+}
+
+// Kick removes a member from the room once the hook calling it returns, e.g., because
+// they were caught cheating, and posts a system message saying so.
+func (h Room) Kick(player *Client) {
+	if !h.live() || h.r.memberIndex(player) < 0 {
+		return
+	}
+	h.r.postNote(protocol.ChatSystem, player.ID, player.Name+" was kicked by "+h.r.currentGameID)
+	h.r.evict(player, closeKicked)
+}
+
+// Emit reports an event to ServerConfig.OnGameEvent, if it is set.
+func (h Room) Emit(eventType string, data any) {
+	if !h.live() || h.r.onGameEvent == nil {
+		return
+	}
+	h.r.onGameEvent(GameEvent{
+		RoomID: h.r.ID,
+		GameID: h.r.currentGameID,
+		Type:   eventType,
+		Data:   data,
+		Time:   time.Now(),
+	})
+}
+
+// After calls fn from the room's processing goroutine, like any other hook, once the
+// given amount of time has passed in the game, e.g., for a turn clock. Time stops while
+// the game is paused, and timers never fire once the game is gone. The returned
+// function cancels the timer if it has not fired yet.
+func (h Room) After(d time.Duration, fn func(players []*Client)) (cancel func()) {
+	if !h.live() {
+		return func() {}
+	}
+
+	t := h.r.addTimer(d, fn)
+	return func() {
+		if h.live() {
+			h.r.cancelTimer(t)
+		}
+	}
+}
+
+// bootGame starts a new instance of the game registered under the given ID, assuming no
+// game is running.
+func (r *room) bootGame(id string, factory Game) {
+	r.currentGameID = id
+	r.jsonGame, _ = factory.(JSONGame)
+	r.broadcastState(&protocol.SetGameState{GameID: id}, false)
+	r.currentGame = factory.NewInstance()
+	r.gameGen++
+	r.callGame("Init", nil, nil, func() {
+		r.currentGame.Init(Room{r, r.gameGen}, r.members)
+	})
+	r.refreshChannels()
+}
+
+// killGame tears down the current game, which must not be nil.
+func (r *room) killGame() {
+	r.callGame("Deinit", nil, nil, r.currentGame.Deinit)
+	r.currentGameID = ""
+	r.currentGame = nil
+	r.jsonGame = nil
+	r.gameAction = gameActionNone
+	r.departed = nil
+	r.resetPause()
+	r.undoVotes = nil
+	r.dropTimers()
+	r.broadcastState(&protocol.SetGameState{}, false)
+	r.dropGameChannels()
+	r.refreshChannels()
+}
+
+// flushGameAction does whatever the current game asked for with EndGame or Rematch
+// while the last event was being processed.
+func (r *room) flushGameAction() {
+	action := r.gameAction
+	if action == gameActionNone {
+		return
+	}
+	if r.currentGame == nil {
+		r.gameAction = gameActionNone
+		return
+	}
+	if action == gameActionCrash {
+		r.crashGame()
+		return
+	}
+
+	id := r.currentGameID
+	r.killGame()
+	if action == gameActionEnd {
+		r.postNote(protocol.ChatSystem, uuid.Nil, id+" ended")
+		return
+	}
+
+	r.bootGame(id, r.gameRegistry[id])
+	r.postNote(protocol.ChatSystem, uuid.Nil, "Started a rematch of "+id)
+}
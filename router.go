@@ -0,0 +1,182 @@
+package games
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/samclaus/games/wire"
+)
+
+// Errors a Router reports when rejecting requests, wrapped in a *RequestError.
+var (
+	ErrUnknownRequest = errors.New("unknown request type")
+	ErrNotYourTurn    = errors.New("not the player's turn")
+	ErrWrongPhase     = errors.New("not allowed in the current phase")
+)
+
+// RequestError is the error a Router reports for every rejected request, whether it
+// could not be decoded, failed a precondition, or was rejected by its handler.
+type RequestError struct {
+	Op   byte
+	Name string // empty if Op is unknown
+	Err  error
+}
+
+func (e *RequestError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("request %d: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s request: %v", e.Name, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Request is a game-scope request being handled by a Router. Client references are NOT
+// safe to retain after the handler returns, just like for GameState.HandleRequest.
+type Request struct {
+	Players []*Client
+	Src     *Client
+	Op      byte
+}
+
+// Precondition is a check a request must pass before its handler is called. A non-nil
+// error rejects the request.
+type Precondition func(req Request) error
+
+// Router implements GameState.HandleRequest for games whose requests are a 1-byte
+// opcode followed by arguments, by dispatching each request to a handler registered for
+// its opcode with Handle. Arguments are read with varint length prefixes (see
+// wire.NewVarintReader), like version 2 of the room protocol. The zero value is ready
+// to use. Like the rest of GameState, a Router must only be used from the room's
+// goroutine.
+type Router struct {
+	routes [256]*route
+
+	// OnReject, if non-nil, is called with the *RequestError for every rejected
+	// request. Rejected requests are logged (in debug builds) either way.
+	OnReject func(req Request, err error)
+	// OnAccept, if non-nil, is called after every request whose handler returned nil,
+	// e.g., to save a checkpoint (see Checkpoints).
+	OnAccept func(req Request)
+}
+
+type route struct {
+	name   string
+	handle func(req Request, args *wire.Reader) error
+}
+
+// Handle registers a handler for the given opcode. Before the handler is called, the
+// arguments are decoded by decode, which must read every byte of them (and may call
+// Fail on the reader to reject values it does not like), and then every precondition is
+// checked in order. A handler may still reject a request by returning an error.
+//
+// The name is only used for reporting. Registering an opcode twice panics.
+func Handle[A any](rt *Router, op byte, name string, decode func(r *wire.Reader) A, handler func(req Request, args A) error, pre ...Precondition) {
+	if rt.routes[op] != nil {
+		panic(fmt.Sprintf("games: request %d registered twice (%s and %s)", op, rt.routes[op].name, name))
+	}
+
+	rt.routes[op] = &route{
+		name: name,
+		handle: func(req Request, r *wire.Reader) error {
+			args := decode(r)
+			if err := r.Done(); err != nil {
+				return err
+			}
+			for _, check := range pre {
+				if err := check(req); err != nil {
+					return err
+				}
+			}
+			return handler(req, args)
+		},
+	}
+}
+
+// NoArgs is the decoder for requests without arguments.
+func NoArgs(*wire.Reader) struct{} {
+	return struct{}{}
+}
+
+// Dispatch decodes and handles a request, reporting it if it gets rejected. Accepting
+// a request clears any votes to undo, since they were about the move before it. It has
+// the same signature as GameState.HandleRequest so games can simply forward to it.
+func (rt *Router) Dispatch(players []*Client, src *Client, payload []byte) {
+	r := wire.NewVarintReader(payload)
+	req := Request{Players: players, Src: src, Op: r.U8()}
+
+	if r.Err() != nil {
+		rt.reject(req, &RequestError{Err: r.Err()})
+		return
+	}
+
+	rte := rt.routes[req.Op]
+	if rte == nil {
+		rt.reject(req, &RequestError{Op: req.Op, Err: ErrUnknownRequest})
+		return
+	}
+
+	if err := rte.handle(req, &r); err != nil {
+		rt.reject(req, &RequestError{Op: req.Op, Name: rte.name, Err: err})
+		return
+	}
+
+	// Votes to undo were about the move before this one
+	if src.room != nil {
+		src.room.clearUndoVotes()
+	}
+
+	if rt.OnAccept != nil {
+		rt.OnAccept(req)
+	}
+}
+
+func (rt *Router) reject(req Request, err *RequestError) {
+	if req.Src.room != nil {
+		req.Src.room.debug("Rejected request from %q: %v", req.Src.Name, err)
+	}
+	if rt.OnReject != nil {
+		rt.OnReject(req, err)
+	}
+}
+
+// PhaseIn returns a precondition which passes if *phase, read whenever a request comes
+// in, is one of the given phases.
+func PhaseIn[P comparable](phase *P, phases ...P) Precondition {
+	return func(Request) error {
+		for _, p := range phases {
+			if *phase == p {
+				return nil
+			}
+		}
+		return ErrWrongPhase
+	}
+}
+
+// TurnOf returns a precondition which passes if it is the requesting player's turn,
+// meaning of(src) equals *turn, read whenever a request comes in. For example, turn
+// might be the index of the player whose turn it is and of might look up the index of
+// the requesting player.
+func TurnOf[T comparable](turn *T, of func(src *Client) T) Precondition {
+	return func(req Request) error {
+		if of(req.Src) != *turn {
+			return ErrNotYourTurn
+		}
+		return nil
+	}
+}
+
+// Require returns a precondition which passes if ok returns true, and otherwise rejects
+// the request with the given reason.
+func Require(reason string, ok func(req Request) bool) Precondition {
+	err := errors.New(reason)
+
+	return func(req Request) error {
+		if !ok(req) {
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,124 @@
+package games
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// outgoing is a message queued for a client's write goroutine, along with the sequence
+// number it was assigned (which is only written out if the client opted into sequencing).
+// A sequenced client may see gaps in the sequence numbers if snapshots got coalesced.
+type outgoing struct {
+	seq uint32
+
+	// msg is the raw message in the recipient's encoding, which is always set for
+	// messages going to sequenced clients, but may be nil if prepared is set and every
+	// recipient is unsequenced
+	msg []byte
+
+	// prepared is the message as a WebSocket frame shared between every (unsequenced)
+	// recipient of a broadcast, or nil if the message only goes to one client
+	prepared *websocket.PreparedMessage
+
+	size     int    // length of the raw message, even if msg is nil
+	kind     uint16 // binary scope and message type header bytes; see kindOf()
+	snapshot bool   // see Client.SendSnapshot()
+}
+
+func newOutgoing(msg []byte, kind uint16, snapshot bool) outgoing {
+	return outgoing{msg: msg, size: len(msg), kind: kind, snapshot: snapshot}
+}
+
+// sendQueue is the queue of outgoing messages between the room goroutine and a
+// client's write goroutine. It is used instead of a plain channel so that a snapshot
+// which has not been written yet can be dropped in favor of a newer snapshot of the
+// same kind, which means a client on a briefly-slow connection only falls behind by
+// one snapshot rather than being flooded (and eventually kicked) for it.
+type sendQueue struct {
+	mtx    sync.Mutex
+	msgs   []outgoing
+	nbytes int
+	closed bool
+	reason []byte // close frame payload, only valid if closed
+
+	// ready has a buffer of 1 and gets a value whenever messages are pushed or the
+	// queue is closed, so the write goroutine can select on it
+	ready chan struct{}
+}
+
+func newSendQueue() *sendQueue {
+	return &sendQueue{
+		msgs:  make([]outgoing, 0, 16),
+		ready: make(chan struct{}, 1),
+	}
+}
+
+func (q *sendQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// push appends a message to the queue, first removing any queued snapshot of the same
+// kind if the new message is itself a snapshot. Returns the number of messages and bytes
+// left waiting, or -1 for both if the queue has been closed.
+func (q *sendQueue) push(out outgoing) (int, int) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.closed {
+		return -1, -1
+	}
+
+	if out.snapshot {
+		for i, queued := range q.msgs {
+			if queued.snapshot && queued.kind == out.kind {
+				q.nbytes -= queued.size
+				q.msgs = append(q.msgs[:i], q.msgs[i+1:]...)
+				break
+			}
+		}
+	}
+
+	q.msgs = append(q.msgs, out)
+	q.nbytes += out.size
+	q.signal()
+
+	return len(q.msgs), q.nbytes
+}
+
+// close discards any queued messages and tells the write goroutine to send a close
+// frame with the given payload and exit. Closing an already-closed queue does nothing.
+func (q *sendQueue) close(reason []byte) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.closed {
+		return
+	}
+
+	q.closed = true
+	q.reason = reason
+	q.msgs = nil
+	q.nbytes = 0
+	q.signal()
+}
+
+// take moves every queued message into dst (which should be empty) and returns it,
+// along with the close frame payload if the queue has been closed.
+func (q *sendQueue) take(dst []outgoing) ([]outgoing, bool, []byte) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.closed {
+		return dst, true, q.reason
+	}
+
+	dst = append(dst, q.msgs...)
+	q.msgs = q.msgs[:0]
+	q.nbytes = 0
+
+	return dst, false, nil
+}
@@ -0,0 +1,88 @@
+package games
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSendQueueCoalescesSnapshots(t *testing.T) {
+	// Each message is its own byte, so what's left in the queue is easy to read off
+	msg := func(id byte, kind uint16, snapshot bool) outgoing {
+		return newOutgoing([]byte{id}, kind, snapshot)
+	}
+
+	tests := []struct {
+		name   string
+		pushes []outgoing
+		want   []byte
+	}{
+		{
+			name:   "plain messages pile up",
+			pushes: []outgoing{msg(1, 7, false), msg(2, 7, false), msg(3, 7, false)},
+			want:   []byte{1, 2, 3},
+		},
+		{
+			name:   "newer snapshot replaces older one of the same kind",
+			pushes: []outgoing{msg(1, 7, true), msg(2, 8, false), msg(3, 7, true)},
+			want:   []byte{2, 3},
+		},
+		{
+			name:   "snapshots of different kinds are kept",
+			pushes: []outgoing{msg(1, 7, true), msg(2, 8, true), msg(3, 7, true), msg(4, 8, true)},
+			want:   []byte{3, 4},
+		},
+		{
+			name:   "plain message doesn't replace a snapshot",
+			pushes: []outgoing{msg(1, 7, true), msg(2, 7, false)},
+			want:   []byte{1, 2},
+		},
+		{
+			name:   "snapshot doesn't replace a plain message",
+			pushes: []outgoing{msg(1, 7, false), msg(2, 7, true)},
+			want:   []byte{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newSendQueue()
+
+			var n, nbytes int
+			for _, out := range tt.pushes {
+				n, nbytes = q.push(out)
+			}
+			if n != len(tt.want) || nbytes != len(tt.want) {
+				t.Errorf("push reported %d messages and %d bytes, want %d of each", n, nbytes, len(tt.want))
+			}
+
+			queued, closed, _ := q.take(nil)
+			if closed {
+				t.Fatal("queue closed")
+			}
+
+			got := make([]byte, len(queued))
+			for i, out := range queued {
+				got[i] = out.msg[0]
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queued %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendQueueClose(t *testing.T) {
+	q := newSendQueue()
+	q.push(newOutgoing([]byte("hi"), 1, false))
+	q.close([]byte("bye"))
+	q.close([]byte("again"))
+
+	if n, nbytes := q.push(newOutgoing([]byte("late"), 1, false)); n != -1 || nbytes != -1 {
+		t.Errorf("push after close reported %d messages and %d bytes, want -1 for both", n, nbytes)
+	}
+
+	queued, closed, reason := q.take(nil)
+	if !closed || len(queued) != 0 || string(reason) != "bye" {
+		t.Errorf("take after close = %d messages, %v, %q; want none, true, \"bye\"", len(queued), closed, reason)
+	}
+}
@@ -1,10 +1,14 @@
 package games
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -13,14 +17,22 @@ import (
 const (
 	idCookieName   = "id"
 	maxRoomMembers = 15
+	maxNameLen     = 64 // in bytes, for player and room names alike
 )
 
 type server struct {
-	upgrader websocket.Upgrader
-	games    map[string]Game
-	rooms    map[uint32]*room
-	roomCtr  uint32
-	roomsMtx sync.RWMutex
+	ctx         context.Context
+	upgrader    websocket.Upgrader
+	games       map[string]Game
+	slowClients SlowClientPolicy
+	compression CompressionConfig
+	chatFilter  ChatFilter
+	chatHistory int
+	onGameEvent func(GameEvent)
+	metrics     *metrics
+	rooms       map[uint32]*room
+	roomCtr     uint32
+	roomsMtx    sync.RWMutex
 }
 
 // HandleGetRooms performs no authentication and responds with a single JSON object
@@ -47,9 +59,18 @@ func (s *server) HandleGetRooms(w http.ResponseWriter, r *http.Request) {
 // HandleConnect attempts to connect the client to a room, establishing a WebSocket
 // connection. Expects the following URL query parameters:
 //
-// - "name": initial name for the player, which they can edit later
-// - "room": room ID or "new" if creating a new room
-// - "room-name": name for the room, only expected/relevant if creating new room
+//   - "name": initial name for the player, which they can edit later
+//   - "room": room ID or "new" if creating a new room
+//   - "room-name": name for the room, only expected/relevant if creating new room
+//   - "seq": optional; if present (even if empty), every message sent to the client will
+//     be prefixed with a uint32 sequence number (or given a "seq" key if using JSON), and
+//     a nonzero value is taken to be the last sequence number the client received over a
+//     previous connection to the room, so that the room can replay whatever it missed
+//     rather than starting over
+//
+// Names may be at most maxNameLen bytes of UTF-8. Clients may also ask for the
+// protocol.SubprotocolBinaryV2 WebSocket subprotocol to get the newer binary encoding,
+// or protocol.SubprotocolJSON to have every message encoded as JSON rather than binary.
 func (s *server) HandleJoinRoom(w http.ResponseWriter, r *http.Request) {
 	debug("Got join room request")
 
@@ -81,74 +102,176 @@ func (s *server) HandleJoinRoom(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Must specify a player name with 'name' URL query parameter", http.StatusBadRequest)
 		return
 	}
+	if !validName(playerName) {
+		debug("Client provided invalid player name: %q", playerName)
+		http.Error(w, "Player name must be valid UTF-8 and at most "+strconv.Itoa(maxNameLen)+" bytes", http.StatusBadRequest)
+		return
+	}
+
+	_, sequenced := r.URL.Query()["seq"]
+	var resumeFrom uint32
+
+	if seqStr := r.URL.Query().Get("seq"); seqStr != "" {
+		seq, err := strconv.ParseUint(seqStr, 10, 32)
+		if err != nil {
+			debug("Got INVALID sequence number: %q", seqStr)
+			http.Error(w, "Invalid 'seq' URL query parameter", http.StatusBadRequest)
+			return
+		}
+		resumeFrom = uint32(seq)
+	}
 
 	var rm *room
+	var roomName string
 
 	if newRoom {
-		roomName := r.URL.Query().Get("room-name")
+		roomName = r.URL.Query().Get("room-name")
 		if roomName == "" {
 			debug("Client did not provide room name")
 			http.Error(w, "Must specify a name for the room with 'room-name' URL query parameter", http.StatusBadRequest)
 			return
 		}
-
-		s.roomsMtx.Lock()
-
-		rm = &room{
-			gameRegistry: s.games,
-			ID:           s.roomCtr,
-			Name:         roomName,
-			members:      make([]*Client, 0, maxRoomMembers),
-			register:     make(chan *Client),
-			unregister:   make(chan *Client),
-			requests:     make(chan request, 100),
-			chat:         &chatBuffer{},
+		if !validName(roomName) {
+			debug("Client provided invalid room name: %q", roomName)
+			http.Error(w, "Room name must be valid UTF-8 and at most "+strconv.Itoa(maxNameLen)+" bytes", http.StatusBadRequest)
+			return
 		}
-
-		s.roomCtr++
-		s.rooms[rm.ID] = rm
-		s.roomsMtx.Unlock()
-
-		// This is where the magic begins
-		go func() {
-			rm.processEventsUntilClosed()
-
-			s.roomsMtx.Lock()
-			delete(s.rooms, rm.ID)
-			s.roomsMtx.Unlock()
-		}()
 	} else {
 		if roomID, err := strconv.ParseUint(roomCode, 10, 32); err == nil {
 			s.roomsMtx.RLock()
 			rm = s.rooms[uint32(roomID)]
 			s.roomsMtx.RUnlock()
 		}
-		if rm == nil {
-			return // handles both invalid ID format and nonexistent cases
+		if rm == nil || !rm.open() {
+			// Handles invalid ID format, nonexistent, and closing cases
+			debug("Client tried to join nonexistent room: %q", roomCode)
+			http.Error(w, "Room does not exist", http.StatusNotFound)
+			return
 		}
 	}
 
+	// When compressing, we need to see how many bytes actually hit the wire to
+	// report the compression ratio
+	var counter *countingResponseWriter
+	if s.compression.Enabled {
+		counter = &countingResponseWriter{ResponseWriter: w}
+		w = counter
+	}
+
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		// If we were creating a brand new room, we can go ahead and delete it since
-		// the client doesn't even know the room ID yet
-		if newRoom {
-			s.roomsMtx.Lock()
-			delete(s.rooms, rm.ID)
-			s.roomsMtx.Unlock()
-		}
-
 		// No need to send HTTP error reply because the .Upgrade() call will send
 		// an error response before it returns an error to our code
 		debug("Failed to upgrade connection: %v", err)
 		return
 	}
 
-	cli := &Client{clientID, playerName, conn, rm, make(chan []byte, 100)}
-	rm.register <- cli
+	cli := &Client{
+		ID:         clientID,
+		Name:       playerName,
+		conn:       conn,
+		queue:      newSendQueue(),
+		enc:        encodingForSubprotocol(conn.Subprotocol()),
+		sequenced:  sequenced,
+		resumeFrom: resumeFrom,
+		metrics:    s.metrics,
+	}
+	if sequenced {
+		cli.session = &session{}
+	}
+	if counter != nil && counter.conn != nil && offersDeflate(r) {
+		conn.SetCompressionLevel(*s.compression.Level)
+		cli.wire = counter.conn
+		cli.compressMin = s.compression.MinSize
+	}
+
+	if newRoom {
+		// The room isn't created until the upgrade succeeds so that there is never an
+		// empty room sitting around, and nobody else can see the room until its first
+		// member is registered, so it is safe to do that from this goroutine
+		rm = s.newRoom(roomName)
+		cli.room = rm
+		rm.registerMember(cli)
+
+		s.roomsMtx.Lock()
+		s.rooms[rm.ID] = rm
+		s.roomsMtx.Unlock()
+
+		go s.runRoom(rm)
+	} else {
+		cli.room = rm
+
+		if !rm.join(cli) {
+			// The room closed between looking it up and now
+			debug("Room %d closed before client could join", rm.ID)
+			conn.WriteControl(websocket.CloseMessage, closeShutdown.frame(), time.Now().Add(sendToClientWait))
+			conn.Close()
+			return
+		}
+	}
 
 	// Start read/write in new goroutine so we can return from this HTTP handler and let the
 	// request and response writer (etc.) get cleaned up
 	go cli.readPump()
 	go cli.writePump()
 }
+
+// newRoom allocates a room with a fresh ID, but does not add it to the room map or
+// start its goroutine.
+func (s *server) newRoom(name string) *room {
+	ctx, cancel := context.WithCancel(s.ctx)
+
+	s.roomsMtx.Lock()
+	id := s.roomCtr
+	s.roomCtr++
+	s.roomsMtx.Unlock()
+
+	return &room{
+		gameRegistry: s.games,
+		slowClients:  s.slowClients,
+		chatFilter:   s.chatFilter,
+		chatHistory:  s.chatHistory,
+		onGameEvent:  s.onGameEvent,
+		metrics:      s.metrics,
+		ctx:          ctx,
+		cancel:       cancel,
+		ID:           id,
+		Name:         name,
+		members:      make([]*Client, 0, maxRoomMembers),
+		register:     make(chan *Client),
+		unregister:   make(chan *Client),
+		requests:     make(chan request, 100),
+		chat:         newChatBuffer(s.chatHistory),
+		channels:     make(map[string]*chatBuffer),
+	}
+}
+
+// runRoom processes events for the room until it closes, then cleans up after it.
+func (s *server) runRoom(rm *room) {
+	// This is where the magic begins
+	rm.processEventsUntilClosed()
+
+	s.roomsMtx.Lock()
+	delete(s.rooms, rm.ID)
+	s.roomsMtx.Unlock()
+
+	// Anyone still trying to hand something to the room gives up once this is canceled
+	rm.cancel()
+	rm.state.Store(int32(roomClosed))
+}
+
+// validName reports whether s is acceptable as a player or room name.
+func validName(s string) bool {
+	return len(s) <= maxNameLen && utf8.ValidString(s)
+}
+
+// offersDeflate returns true if the client offered the permessage-deflate extension,
+// in which case the websocket.Upgrader will have accepted it.
+func offersDeflate(r *http.Request) bool {
+	for _, ext := range r.Header.Values("Sec-WebSocket-Extensions") {
+		if strings.Contains(ext, "permessage-deflate") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package games
+
+import (
+	"time"
+)
+
+const (
+	// How many of the most recent messages sent to each sequenced member are retained
+	// so they can be replayed if the member reconnects. Replayed messages are queued
+	// without checking the SlowClientPolicy, but they still count towards it for any
+	// message sent after them, so this should be smaller than the default limit.
+	replayBufferSize = 64
+
+	// How long a sequenced member whose connection died is kept in the room, with
+	// messages accumulating in their replay buffer, before they are removed for good.
+	resumeGracePeriod = 30 * time.Second
+
+	// How often the room checks for detached members whose grace period has expired.
+	sweepInterval = 5 * time.Second
+)
+
+// session tracks the sequence numbers and recently-sent messages for one member so that
+// a new connection from the same client can pick up where the old one left off. A
+// session is shared by every connection which successfully resumes it, and is only
+// ever touched by the room goroutine.
+type session struct {
+	seq    uint32 // sequence number of the last message sent; the first message is 1
+	replay [replayBufferSize][]byte
+
+	// detachedAt is when the member's connection died, or the zero time if the member
+	// is currently connected
+	detachedAt time.Time
+}
+
+func (s *session) detached() bool {
+	return !s.detachedAt.IsZero()
+}
+
+// record assigns the next sequence number to the given message and retains it in the
+// replay buffer, possibly evicting the oldest retained message.
+func (s *session) record(msg []byte) uint32 {
+	s.seq++
+	s.replay[s.seq%replayBufferSize] = msg
+	return s.seq
+}
+
+// appendMissed appends every message sent after lastSeen to dst, returning false if
+// some of those messages are no longer retained, in which case the client needs a
+// full resync.
+func (s *session) appendMissed(dst []outgoing, lastSeen uint32) ([]outgoing, bool) {
+	if lastSeen > s.seq || s.seq-lastSeen > replayBufferSize {
+		return dst, false
+	}
+	for seq := lastSeen + 1; seq <= s.seq && seq != 0; seq++ {
+		out := newOutgoing(s.replay[seq%replayBufferSize], 0, false)
+		out.seq = seq
+		dst = append(dst, out)
+	}
+	return dst, true
+}
@@ -0,0 +1,73 @@
+package games
+
+import (
+	"testing"
+)
+
+func TestSessionAppendMissed(t *testing.T) {
+	tests := []struct {
+		name     string
+		recorded int    // how many messages were sent
+		lastSeen uint32 // last sequence number the client saw
+		wantOK   bool
+		wantSeqs []uint32 // first and last replayed sequence numbers, if any
+	}{
+		{name: "nothing sent", recorded: 0, lastSeen: 0, wantOK: true},
+		{name: "nothing missed", recorded: 10, lastSeen: 10, wantOK: true},
+		{name: "some missed", recorded: 10, lastSeen: 7, wantOK: true, wantSeqs: []uint32{8, 10}},
+		{name: "everything missed", recorded: 10, lastSeen: 0, wantOK: true, wantSeqs: []uint32{1, 10}},
+		{
+			name:     "buffer wrapped around",
+			recorded: replayBufferSize*3 + 5,
+			lastSeen: replayBufferSize*2 + 10,
+			wantOK:   true,
+			wantSeqs: []uint32{replayBufferSize*2 + 11, replayBufferSize*3 + 5},
+		},
+		{
+			name:     "exactly a buffer's worth missed",
+			recorded: replayBufferSize * 2,
+			lastSeen: replayBufferSize,
+			wantOK:   true,
+			wantSeqs: []uint32{replayBufferSize + 1, replayBufferSize * 2},
+		},
+		{name: "gap too big", recorded: replayBufferSize * 2, lastSeen: replayBufferSize - 1, wantOK: false},
+		{name: "client is ahead", recorded: 10, lastSeen: 11, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s session
+			for i := 1; i <= tt.recorded; i++ {
+				if seq := s.record([]byte{byte(i)}); seq != uint32(i) {
+					t.Fatalf("message %d got sequence number %d", i, seq)
+				}
+			}
+
+			missed, ok := s.appendMissed(nil, tt.lastSeen)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+
+			if len(tt.wantSeqs) == 0 {
+				if len(missed) != 0 {
+					t.Errorf("replayed %d messages, want none", len(missed))
+				}
+				return
+			}
+
+			first, last := tt.wantSeqs[0], tt.wantSeqs[1]
+			if want := int(last - first + 1); len(missed) != want {
+				t.Fatalf("replayed %d messages, want %d", len(missed), want)
+			}
+			for i, out := range missed {
+				seq := first + uint32(i)
+				if out.seq != seq || out.msg[0] != byte(seq) {
+					t.Errorf("message %d is seq %d with body %d, want seq and body %d", i, out.seq, out.msg[0], byte(seq))
+				}
+			}
+		})
+	}
+}
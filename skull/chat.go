@@ -0,0 +1,56 @@
+package skull
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/samclaus/games"
+)
+
+var errNoScores = errors.New("nobody has played yet")
+
+func (g *gameState) ChatCommands() []games.ChatCommand {
+	return []games.ChatCommand{
+		{Name: "score", Help: "show everyone's points and cards", Run: g.scoreCommand},
+	}
+}
+
+// scoreCommand lists each player in the current (or last) game, one per line, like
+// "alice: 1 point, 3 cards".
+func (g *gameState) scoreCommand(players []*games.Client, _ *games.Client, _ []string) (string, error) {
+	if g.phase == phaseNoGame || g.nplayers == 0 {
+		return "", errNoScores
+	}
+
+	var sb strings.Builder
+	for i := uint8(0); i < g.nplayers; i++ {
+		h := &g.hands[i]
+
+		sb.WriteString(playerName(players, h.id))
+		sb.WriteString(": ")
+		sb.WriteString(count(h.score, "point"))
+		if h.hasCards() {
+			sb.WriteString(", ")
+			sb.WriteString(count(h.hcards+h.pcards, "card"))
+		} else {
+			sb.WriteString(", out")
+		}
+		if h.status == statusLeft {
+			sb.WriteString(", left")
+		}
+		if g.phase == phaseWinner && h.id == g.winner {
+			sb.WriteString(", winner")
+		}
+		sb.WriteByte('\n')
+	}
+
+	return sb.String(), nil
+}
+
+func count(n uint8, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return strconv.Itoa(int(n)) + " " + unit + "s"
+}
@@ -37,6 +37,18 @@ type gameState struct {
 	passed   uint16    // bitset of hand/player indices that passed and cannot bid this time
 	taker    uint8     // index of hand/player whose skull got picked by bidder; takes card from bidder
 	winner   uuid.UUID // ID of client that won game; only valid for phaseWinner
+	room     games.Room
+	router   games.Router
+
+	// history holds a checkpoint from after each move in the current game, for undoing
+	// them (see undo.go)
+	history games.Checkpoints[checkpoint]
+}
+
+func newGameState() *gameState {
+	g := &gameState{}
+	g.registerRequests()
+	return g
 }
 
 // Shifts all claimed hands to the left of the array, marks any
@@ -70,21 +82,89 @@ func (g *gameState) getHand(clientID uuid.UUID) (uint8, *hand) {
 
 // Finds the next player, in order (and handling loop-around), who still has
 // at least one card, which could be held or played. I.e., ignores players
-// who have been eliminated by losing all of their cards.
+// who have been eliminated by losing all of their cards, and players who
+// left the game.
 func (g *gameState) nextTurn() {
 	for i := uint8(0); i < g.nplayers; i++ {
 		g.turn = (g.turn + 1) % g.nplayers
 
+		// Once the turn gets back around to the bidder, they must pick, even if
+		// they left (the game waits for them to come back)
+		if g.phase == phaseBid && g.turn == g.bidder {
+			break
+		}
+
 		// TODO: can I refactor this somehow so that it's not always running
 		// the bidding phase logic where it needs to skip over players who
 		// have already chosen to pass up the bid
 		if (g.phase != phaseBid || (1<<g.turn)&g.passed == 0) &&
-			g.hands[g.turn].hasCards() {
+			g.hands[g.turn].hasCards() &&
+			g.hands[g.turn].status == statusClaimed {
 			break
 		}
 	}
 }
 
+// passTurn moves on to the next player during the bidding phase, entering the
+// picking phase if we have cycled all the way back to the most recent bidder.
+func (g *gameState) passTurn() {
+	g.nextTurn()
+
+	// If we have cycled all the way back to the most recent bidder,
+	// the game enters the picking phase where that bidder must
+	// successfully pick the number of cards they bid!
+	if g.turn == g.bidder {
+		g.phase = phasePick
+		g.passed = 0
+	}
+}
+
+// findHand returns the index of the hand belonging to the given client, even if
+// they left the game, or -1 if they don't have one.
+func (g *gameState) findHand(clientID uuid.UUID) int {
+	for i := range g.hands {
+		if g.hands[i].status != statusUnclaimed && g.hands[i].id == clientID {
+			return i
+		}
+	}
+	return -1
+}
+
+// dropHand handles a player leaving the game, whether they asked to or left the
+// room. Their hand is up for grabs if no game is active; otherwise it stays in
+// the game so that they can come back, and their turns are skipped while they
+// are gone. If the game can't go on without them (e.g., they have to pick cards
+// because they won the bid), it waits for them to come back.
+func (g *gameState) dropHand(players []*games.Client, pos uint8, name string) {
+	if !g.phase.Active() {
+		g.hands[pos].status = statusUnclaimed
+		return
+	}
+
+	g.hands[pos].status = statusLeft
+	if pos == g.turn && !g.skipLeftTurn() {
+		games.Narrate(players, name+" left, waiting for them to come back")
+	}
+}
+
+// skipLeftTurn moves on to the next player if it is the turn of a player who left the
+// game, returning false if the game can't go on without them.
+func (g *gameState) skipLeftTurn() bool {
+	if !g.phase.Active() || g.hands[g.turn].status != statusLeft {
+		return true
+	}
+
+	switch g.phase {
+	case phasePlay:
+		g.nextTurn()
+	case phaseBid:
+		g.passTurn()
+	default:
+		return false
+	}
+	return true
+}
+
 func (g *gameState) reclaimPlayedCards() {
 	g.pcards = 0
 
@@ -94,20 +174,49 @@ func (g *gameState) reclaimPlayedCards() {
 }
 
 func (g *gameState) broadcastFullState(players []*games.Client) {
-	msg := g.encodeFullStateMessage()
-	for _, p := range players {
-		p.Send(msg)
-	}
+	games.BroadcastSnapshot(players, g.encodeFullStateMessage())
 }
 
-func (g *gameState) Init(players []*games.Client) {
+func (g *gameState) Init(room games.Room, players []*games.Client) {
+	g.room = room
 	g.broadcastFullState(players)
 }
 
 func (g *gameState) HandleNewPlayer(c *games.Client) {
-	c.Send(g.encodeFullStateMessage())
+	c.SendSnapshot(g.encodeFullStateMessage())
+}
+
+func (g *gameState) HandlePlayerLeft(players []*games.Client, c *games.Client) {
+	pos := g.findHand(c.ID)
+	if pos < 0 || g.hands[pos].status == statusLeft {
+		return
+	}
+
+	g.dropHand(players, uint8(pos), c.Name)
+	g.broadcastFullState(players)
+}
+
+func (g *gameState) HandlePlayerRejoined(players []*games.Client, c *games.Client) {
+	pos := g.findHand(c.ID)
+	if pos < 0 || g.hands[pos].status != statusLeft {
+		return
+	}
+
+	g.hands[pos].status = statusClaimed
+	g.broadcastFullState(players)
 }
 
 func (g *gameState) Deinit() {
 	// Nothing for now
 }
+
+// playerName returns the name of the player with the given ID, for narration, or
+// "someone" if they are no longer in the room.
+func playerName(players []*games.Client, id uuid.UUID) string {
+	for _, c := range players {
+		if c.ID == id {
+			return c.Name
+		}
+	}
+	return "someone"
+}
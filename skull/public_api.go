@@ -1,7 +1,10 @@
 package skull
 
 import (
+	_ "embed"
+
 	"github.com/samclaus/games"
+	"github.com/samclaus/games/protocol"
 )
 
 type game struct{}
@@ -15,9 +18,19 @@ func (g game) Version() int {
 }
 
 func (g game) NewInstance() games.GameState {
-	return &gameState{}
+	return newGameState()
 }
 
 func Game() games.Game {
 	return game{}
 }
+
+//go:embed protocol.json
+var protocolJSON []byte
+
+// Protocol satisfies (github.com/samclaus/games).DescribedGame.
+func (g game) Protocol() protocol.Schema {
+	return protocol.MustParseSchema(protocolJSON)
+}
+
+var _ games.DescribedGame = game{}
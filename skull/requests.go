@@ -1,10 +1,13 @@
 package skull
 
 // This file contains types and deserialization code for every type of request a player can
-// make to the server.
+// make to the server. Any change to the requests must also be made to protocol.json.
 
 import (
+	"errors"
+
 	"github.com/samclaus/games"
+	"github.com/samclaus/games/wire"
 )
 
 const (
@@ -21,308 +24,292 @@ const (
 	reqTakeCard
 )
 
+var (
+	errNoHand       = errors.New("player does not have a hand")
+	errSeatTaken    = errors.New("seat is taken or cannot be changed")
+	errInvalidIndex = errors.New("invalid index")
+	errInvalidBid   = errors.New("invalid bid")
+)
+
+// cardMove is the argument of a reqMoveCard request.
+type cardMove struct {
+	from, to uint8
+}
+
+func decodeCardMove(r *wire.Reader) cardMove {
+	return cardMove{r.U8(), r.U8()}
+}
+
+// registerRequests registers a handler for every type of request with the game's router.
+func (g *gameState) registerRequests() {
+	rt := &g.router
+	rt.OnAccept = g.saveCheckpoint
+	u8 := (*wire.Reader).U8
+
+	// It is the requester's turn (which also handles the case where they don't have a
+	// hand, because getHand() returns an out-of-range position)
+	myTurn := games.TurnOf(&g.turn, func(src *games.Client) uint8 {
+		pos, _ := g.getHand(src.ID)
+		return pos
+	})
+	active := games.Require("no game in progress", func(games.Request) bool {
+		return g.phase.Active()
+	})
+
+	games.Handle(rt, reqJoinGame, "join_game", u8, g.joinGame)
+	games.Handle(rt, reqLeaveGame, "leave_game", games.NoArgs, g.leaveGame)
+	games.Handle(rt, reqRestartGame, "restart_game", games.NoArgs, g.restartGame)
+	games.Handle(rt, reqAbortGame, "abort_game", games.NoArgs, g.abortGame, active)
+	games.Handle(rt, reqPlay, "play", u8, g.play, games.PhaseIn(&g.phase, phasePlay), myTurn)
+	games.Handle(rt, reqBid, "bid", u8, g.placeBid, games.PhaseIn(&g.phase, phasePlay, phaseBid), myTurn)
+	games.Handle(rt, reqPass, "pass", games.NoArgs, g.pass, games.PhaseIn(&g.phase, phaseBid), myTurn)
+	games.Handle(rt, reqPick, "pick", u8, g.pick, games.PhaseIn(&g.phase, phasePick), myTurn)
+	games.Handle(rt, reqMoveCard, "move_card", decodeCardMove, g.moveCard, active)
+	games.Handle(rt, reqDoneShuffling, "done_shuffling", games.NoArgs, g.doneShuffling, games.PhaseIn(&g.phase, phaseBidderShuffle), myTurn)
+	games.Handle(rt, reqTakeCard, "take_card", u8, g.takeCard, games.PhaseIn(&g.phase, phaseTakeCard), myTurn)
+}
+
 // HandleRequest is required to satisfy the (github.com/samclaus/games).GameState interface and
 // implements all turn-based game logic for Skull.
 //
 // TODO: tell room to disconnect client for sending invalid request structure?
 func (g *gameState) HandleRequest(players []*games.Client, src *games.Client, payload []byte) {
-	if len(payload) == 0 {
-		return
-	}
-
-	body := payload[1:]
-	srcID := src.ID
-
-	switch payload[0] {
-	case reqJoinGame:
-		if len(body) != 1 || body[0] > 5 {
-			return
-		}
-
-		requestPos := body[0] // guaranteed range [0, 5] by check above
-		existingPos := -1
+	g.router.Dispatch(players, src, payload)
+}
 
-		for i, hand := range g.hands {
-			if hand.status != statusUnclaimed && hand.id == srcID {
-				existingPos = i
-				break
-			}
-		}
+func (g *gameState) joinGame(req games.Request, requestPos uint8) error {
+	if requestPos >= maxPlayers {
+		return errInvalidIndex
+	}
 
-		hand := &g.hands[requestPos]
-
-		// 1. Rejoining as same position does nothing
-		// 2. Cannot take a hand if we have one and game is active (even if we left it)
-		// 2. Cannot insert new player into active game
-		// 3. Cannot take over existing player's hand unless they surrender it
-		if (existingPos >= 0 && byte(existingPos) == requestPos) ||
-			(existingPos >= 0 && g.phase.Active()) ||
-			(g.phase.Active() && hand.status == statusUnclaimed) ||
-			hand.status == statusClaimed {
-			return
-		}
+	// requestPos guaranteed range [0, 5] by check above
+	existingPos := g.findHand(req.Src.ID)
+	hand := &g.hands[requestPos]
 
+	// Players who left an active game can take their own hand back
+	if existingPos >= 0 && byte(existingPos) == requestPos && hand.status == statusLeft {
 		hand.status = statusClaimed
-		hand.id = srcID
+		g.broadcastFullState(req.Players)
+		return nil
+	}
 
-		if existingPos >= 0 {
-			// We know the game must not be active from checks above, so this basically
-			// means we are just switching our play order before the game begins
-			g.hands[existingPos].status = statusUnclaimed
-		}
+	// 1. Rejoining as same position does nothing
+	// 2. Cannot take a hand if we have one and game is active (even if we left it)
+	// 2. Cannot insert new player into active game
+	// 3. Cannot take over existing player's hand unless they surrender it
+	if (existingPos >= 0 && byte(existingPos) == requestPos) ||
+		(existingPos >= 0 && g.phase.Active()) ||
+		(g.phase.Active() && hand.status == statusUnclaimed) ||
+		hand.status == statusClaimed {
+		return errSeatTaken
+	}
 
-		g.broadcastFullState(players)
+	hand.status = statusClaimed
+	hand.id = req.Src.ID
 
-	case reqLeaveGame:
-		pos := -1
-		for i, hand := range g.hands {
-			if hand.status != statusUnclaimed && hand.id == srcID {
-				pos = i
-				break
-			}
-		}
+	if existingPos >= 0 {
+		// We know the game must not be active from checks above, so this basically
+		// means we are just switching our play order before the game begins
+		g.hands[existingPos].status = statusUnclaimed
+	}
 
-		if pos < 0 {
-			return
-		}
+	g.broadcastFullState(req.Players)
+	return nil
+}
 
-		if g.phase.Active() {
-			g.hands[pos].status = statusLeft
-		} else {
-			g.hands[pos].status = statusUnclaimed
-		}
+func (g *gameState) leaveGame(req games.Request, _ struct{}) error {
+	pos := g.findHand(req.Src.ID)
+	if pos < 0 {
+		return errNoHand
+	}
 
-		g.broadcastFullState(players)
+	// They already left the game, and have to wait for it to end to give up
+	// their hand for good
+	if g.hands[pos].status == statusLeft && g.phase.Active() {
+		return errNoHand
+	}
 
-	case reqRestartGame:
-		g.phase = phasePlay
-		g.turn = 0
-		g.pcards = 0
-		g.bid = 0
-		g.passed = 0
-		g.lockInPlayers()
-		g.broadcastFullState(players)
+	g.dropHand(req.Players, uint8(pos), req.Src.Name)
+	g.broadcastFullState(req.Players)
+	return nil
+}
 
-	case reqAbortGame:
-		if !g.phase.Active() {
-			return
-		}
+func (g *gameState) restartGame(req games.Request, _ struct{}) error {
+	g.phase = phasePlay
+	g.turn = 0
+	g.pcards = 0
+	g.bid = 0
+	g.passed = 0
+	g.lockInPlayers()
+	g.broadcastFullState(req.Players)
+	return nil
+}
 
-		g.phase = phaseAborted
-		g.broadcastFullState(players)
-
-	case reqPlay:
-		pos, hand := g.getHand(srcID)
-
-		// Ignore request if:
-		// - Game is not in play phase
-		// - It is not their turn (also handles -1 position case meaning they don't have a hand)
-		// - They did provide a valid card index to play
-		if g.phase != phasePlay ||
-			g.turn != pos ||
-			len(body) != 1 ||
-			body[0] >= byte(hand.hcards) {
-			return
-		}
+func (g *gameState) abortGame(req games.Request, _ struct{}) error {
+	g.phase = phaseAborted
+	g.broadcastFullState(req.Players)
+	return nil
+}
 
-		cardIndex := body[0]
+func (g *gameState) play(req games.Request, cardIndex uint8) error {
+	_, hand := g.getHand(req.Src.ID)
 
-		if hand.skullStatus == skullInHand {
-			if cardIndex == hand.skullPos {
-				hand.skullStatus = skullPlayed // they are playing the skull
-				hand.skullPos = hand.pcards    // now skull position is in played cards
-			} else if cardIndex < hand.skullPos {
-				hand.skullPos-- // shift position to account for card removal
-			}
-		}
-
-		hand.pcards++
-		hand.hcards--
+	// They must provide a valid card index to play
+	if cardIndex >= hand.hcards {
+		return errInvalidIndex
+	}
 
-		g.pcards++
-		g.nextTurn()
-		g.broadcastFullState(players)
-
-	case reqBid:
-		pos, _ := g.getHand(srcID)
-
-		// Ignore request if:
-		// 1. Game is not in play OR bid phase
-		// 2. It is not their turn (also handles -1 position case meaning they don't have a hand)
-		// 3. They did not provide a bid (invalid request)
-		// 4. They did not bid higher than current bid (also handles case where they start bidding)
-		// 5. They tried to bid more cards than have been played
-		if !(g.phase == phasePlay || g.phase == phaseBid) ||
-			g.turn != pos ||
-			len(body) != 1 ||
-			body[0] <= g.bid ||
-			body[0] > g.pcards {
-			return
+	if hand.skullStatus == skullInHand {
+		if cardIndex == hand.skullPos {
+			hand.skullStatus = skullPlayed // they are playing the skull
+			hand.skullPos = hand.pcards    // now skull position is in played cards
+		} else if cardIndex < hand.skullPos {
+			hand.skullPos-- // shift position to account for card removal
 		}
+	}
 
-		g.bid = body[0]
-		g.bidder = pos
-
-		if g.bid < g.pcards {
-			g.phase = phaseBid // in case they are starting the bid
-			g.nextTurn()
-		} else {
-			// No one can bid higher, jump right to pick phase
-			g.phase = phasePick
-			g.passed = 0
-		}
+	hand.pcards++
+	hand.hcards--
 
-		g.broadcastFullState(players)
+	g.pcards++
+	g.nextTurn()
+	g.broadcastFullState(req.Players)
+	return nil
+}
 
-	case reqPass:
-		pos, _ := g.getHand(srcID)
+func (g *gameState) placeBid(req games.Request, bid uint8) error {
+	// Reject the bid if:
+	// 1. They did not bid higher than current bid (also handles case where they start bidding)
+	// 2. They tried to bid more cards than have been played
+	if bid <= g.bid || bid > g.pcards {
+		return errInvalidBid
+	}
 
-		// Ignore request if:
-		// 1. Game is not in bid phase
-		// 2. It is not their turn (also handles -1 position case meaning they don't have a hand)
-		if g.phase != phaseBid || g.turn != pos {
-			return
-		}
+	g.bid = bid
+	g.bidder = g.turn
 
+	if g.bid < g.pcards {
+		g.phase = phaseBid // in case they are starting the bid
 		g.nextTurn()
+	} else {
+		// No one can bid higher, jump right to pick phase
+		g.phase = phasePick
+		g.passed = 0
+	}
 
-		// If we have cycled all the way back to the most recent bidder,
-		// the game enters the picking phase where that bidder must
-		// successfully pick the number of cards they bid!
-		if g.turn == g.bidder {
-			g.phase = phasePick
-			g.passed = 0
-		}
+	g.broadcastFullState(req.Players)
+	return nil
+}
 
-		g.broadcastFullState(players)
-
-	case reqPick:
-		pos, hand := g.getHand(srcID)
-
-		// Ignore request if:
-		// 1. Game is not in pick phase
-		// 2. It is not their turn (also handles -1 position case meaning they don't have a hand)
-		// 3. They did not provide a hand index to take a card from (invalid request)
-		// 4. They provided an invalid hand index (too high)
-		if g.phase != phasePick ||
-			g.turn != pos ||
-			len(body) != 1 ||
-			body[0] >= g.nplayers {
-			return
-		}
+func (g *gameState) pass(req games.Request, _ struct{}) error {
+	g.passTurn()
+	g.broadcastFullState(req.Players)
+	return nil
+}
 
-		pickedHandIdx := body[0]
-		pickedHand := &g.hands[pickedHandIdx]
+func (g *gameState) pick(req games.Request, pickedHandIdx uint8) error {
+	_, hand := g.getHand(req.Src.ID)
 
-		if pickedHand.pcards == 0 {
-			return
-		}
+	// They must provide a valid hand index to take a card from, and that hand must
+	// have played cards left
+	if pickedHandIdx >= g.nplayers || g.hands[pickedHandIdx].pcards == 0 {
+		return errInvalidIndex
+	}
 
-		// Decrement first to make skull index check below easier
-		pickedHand.pcards--
-
-		if pickedHand.skullStatus == skullPlayed &&
-			pickedHand.skullPos == pickedHand.pcards {
-			// They picked someone's skull, so after they finish shuffling
-			// their cards, that player gets to take one of their cards
-			g.phase = phaseBidderShuffle
-			g.bid = 0 // reset bid counter
-			g.taker = pickedHandIdx
-			g.reclaimPlayedCards()
-		} else {
-			// Rather than increment a separate score variable and compare it
-			// to their bid, we just decrement the bid and they try to get it
-			// to reach zero, i.e., it represents "remaining cards" they must pick
-			g.bid--
-
-			if g.bid == 0 {
-				// They won their bid
-				hand.score++
-
-				if hand.score > 1 {
-					// They won the game!
-					g.phase = phaseWinner
-					g.winner = srcID
-				} else {
-					g.phase = phasePlay // bidder will play first, no need to update turn
-					g.reclaimPlayedCards()
-				}
+	pickedHand := &g.hands[pickedHandIdx]
+
+	// Decrement first to make skull index check below easier
+	pickedHand.pcards--
+
+	if pickedHand.skullStatus == skullPlayed &&
+		pickedHand.skullPos == pickedHand.pcards {
+		// They picked someone's skull, so after they finish shuffling
+		// their cards, that player gets to take one of their cards
+		games.Narrate(req.Players, req.Src.Name+" flipped "+playerName(req.Players, pickedHand.id)+"'s skull!")
+		g.phase = phaseBidderShuffle
+		g.bid = 0 // reset bid counter
+		g.taker = pickedHandIdx
+		g.reclaimPlayedCards()
+	} else {
+		// Rather than increment a separate score variable and compare it
+		// to their bid, we just decrement the bid and they try to get it
+		// to reach zero, i.e., it represents "remaining cards" they must pick
+		g.bid--
+
+		if g.bid == 0 {
+			// They won their bid
+			hand.score++
+
+			if hand.score > 1 {
+				// They won the game!
+				games.Narrate(req.Players, req.Src.Name+" won the game!")
+				g.room.Emit("won", map[string]string{"id": req.Src.ID.String(), "name": req.Src.Name})
+				g.phase = phaseWinner
+				g.winner = req.Src.ID
+			} else {
+				games.Narrate(req.Players, req.Src.Name+" won their bid")
+				g.phase = phasePlay // bidder will play first, no need to update turn
+				g.reclaimPlayedCards()
 			}
 		}
+	}
 
-		g.broadcastFullState(players)
-
-	case reqMoveCard:
-		_, hand := g.getHand(srcID)
-
-		// Ignore request if:
-		// 1. There is not a game in progress
-		// 2. Requester doesn't own a hand in the game
-		// 3. They did not provide 2 card indices (invalid request)
-		// 4. They provided the same hand index twice (invalid request)
-		// 5. They provided an invalid hand index (too high)
-		if !g.phase.Active() ||
-			hand == nil ||
-			len(body) != 2 ||
-			body[0] == body[1] ||
-			body[0] >= hand.hcards || body[1] >= hand.hcards {
-			return
-		}
-
-		// Moving skull?
-		if hand.skullStatus == skullInHand {
-			if body[0] == hand.skullPos {
-				hand.skullPos = body[1]
-			} else if body[1] == hand.skullPos {
-				hand.skullPos = body[0]
-			}
-		}
+	g.broadcastFullState(req.Players)
+	return nil
+}
 
-		// TODO: how to track/broadcast card positions? Important for life-like gameplay
+func (g *gameState) moveCard(req games.Request, move cardMove) error {
+	_, hand := g.getHand(req.Src.ID)
 
-		g.broadcastFullState(players)
+	// Reject the move if:
+	// 1. Requester doesn't own a hand in the game
+	// 2. They provided the same hand index twice
+	// 3. They provided an invalid hand index (too high)
+	if hand == nil {
+		return errNoHand
+	}
+	if move.from == move.to || move.from >= hand.hcards || move.to >= hand.hcards {
+		return errInvalidIndex
+	}
 
-	case reqDoneShuffling:
-		// Ignore request if:
-		// 1. Game is not in pick phase (early return to avoid linear search for hand)
-		// 2. It is not their turn (also handles -1 position case meaning they don't have a hand)
-		if g.phase != phaseBidderShuffle {
-			return
-		}
-		if pos, _ := g.getHand(srcID); g.turn != pos {
-			return
+	// Moving skull?
+	if hand.skullStatus == skullInHand {
+		if move.from == hand.skullPos {
+			hand.skullPos = move.to
+		} else if move.to == hand.skullPos {
+			hand.skullPos = move.from
 		}
+	}
 
-		g.phase = phaseTakeCard
-		g.turn = g.taker
-		g.broadcastFullState(players)
-
-	case reqTakeCard:
-		pos, _ := g.getHand(srcID)
-		bidder := &g.hands[g.bidder]
-
-		// Ignore request if:
-		// 1. Game is not in take card phase
-		// 2. It is not their turn (also handles -1 position case meaning they don't have a hand)
-		// 3. They did not provide a hand index to take a card from (invalid request)
-		// 4. They provided an invalid hand index (too high)
-		if g.phase != phaseTakeCard ||
-			g.turn != pos ||
-			len(body) != 1 ||
-			body[0] >= bidder.hcards {
-			return
-		}
+	// TODO: how to track/broadcast card positions? Important for life-like gameplay
 
-		cardIdx := body[0]
+	g.broadcastFullState(req.Players)
+	return nil
+}
 
-		if cardIdx == bidder.skullPos {
-			bidder.skullStatus = skullGone
-		} else if cardIdx < bidder.skullPos && bidder.skullStatus == skullInHand {
-			bidder.skullPos--
-		}
+func (g *gameState) doneShuffling(req games.Request, _ struct{}) error {
+	g.phase = phaseTakeCard
+	g.turn = g.taker
+	g.broadcastFullState(req.Players)
+	return nil
+}
 
-		bidder.hcards--
-		g.phase = phasePlay // NOTE: no need to change turn because taker goes first now
-		g.broadcastFullState(players)
+func (g *gameState) takeCard(req games.Request, cardIdx uint8) error {
+	bidder := &g.hands[g.bidder]
+
+	// They must provide a valid index of a card to take from the bidder
+	if cardIdx >= bidder.hcards {
+		return errInvalidIndex
+	}
+
+	if cardIdx == bidder.skullPos {
+		bidder.skullStatus = skullGone
+	} else if cardIdx < bidder.skullPos && bidder.skullStatus == skullInHand {
+		bidder.skullPos--
 	}
+
+	bidder.hcards--
+	g.phase = phasePlay // NOTE: no need to change turn because taker goes first now
+	g.broadcastFullState(req.Players)
+	return nil
 }
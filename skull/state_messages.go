@@ -1,14 +1,15 @@
 package skull
 
 import (
-	"encoding/binary"
-
 	"github.com/google/uuid"
 	"github.com/samclaus/games"
+	"github.com/samclaus/games/wire"
 )
 
 // This file contains constants and serialization code for every kind of
-// message a room will send to clients to update their state.
+// message a room will send to clients to update their state. Any change to
+// the messages must also be made to protocol.json, which is checked by
+// running `go run ./cmd/protogen -check`.
 
 // TODO: optimized binary format and we definitely don't need to send the full
 // state (especially the potentially big player UUID->role mapping) every time
@@ -34,20 +35,27 @@ func (g *gameState) encodeFullStateMessage() []byte {
 		nhands = maxPlayers
 	}
 
-	msg := games.AllocGameMessage(27 + nhands*20)
-	msg = append(msg, stateFull)
-	msg = append(msg, byte(g.phase), g.turn, g.pcards, g.bid, g.bidder)
-	msg = binary.BigEndian.AppendUint16(msg, g.passed)
-	msg = append(msg, g.taker)
-	msg = append(msg, g.winner[:]...)
+	w := wire.NewVarintWriter(games.AllocGameMessage(27 + nhands*20))
+	w.U8(stateFull)
+	w.U8(uint8(g.phase))
+	w.U8(g.turn)
+	w.U8(g.pcards)
+	w.U8(g.bid)
+	w.U8(g.bidder)
+	w.U16(g.passed)
+	w.U8(g.taker)
+	w.UUID(g.winner)
 	// TODO: need to include skull status/position on per-client basis
 
 	for i := 0; i < nhands; i++ {
 		h := &g.hands[i]
 
-		msg = append(msg, h.id[:]...)
-		msg = append(msg, h.status, h.hcards, h.pcards, h.score)
+		w.UUID(h.id)
+		w.U8(h.status)
+		w.U8(h.hcards)
+		w.U8(h.pcards)
+		w.U8(h.score)
 	}
 
-	return msg
+	return w.Bytes()
 }
@@ -0,0 +1,80 @@
+package skull
+
+import (
+	"github.com/google/uuid"
+	"github.com/samclaus/games"
+)
+
+// checkpoint is everything a move can change, for undoing moves.
+type checkpoint struct {
+	hands    [maxPlayers]hand
+	phase    gamePhase
+	nplayers uint8
+	turn     uint8
+	pcards   uint8
+	bid      uint8
+	bidder   uint8
+	passed   uint16
+	taker    uint8
+	winner   uuid.UUID
+}
+
+func (g *gameState) checkpoint() checkpoint {
+	return checkpoint{
+		hands:    g.hands,
+		phase:    g.phase,
+		nplayers: g.nplayers,
+		turn:     g.turn,
+		pcards:   g.pcards,
+		bid:      g.bid,
+		bidder:   g.bidder,
+		passed:   g.passed,
+		taker:    g.taker,
+		winner:   g.winner,
+	}
+}
+
+// saveCheckpoint is called by the router after every accepted request. Taking or
+// leaving a seat isn't a move, so it can't be undone, and neither can starting a new
+// game. Once a game is over (or before one starts) there is nothing to undo, and
+// seats can change hands freely, so the history starts over.
+func (g *gameState) saveCheckpoint(req games.Request) {
+	switch {
+	case !g.phase.Active() || req.Op == reqRestartGame:
+		g.history.Reset(g.checkpoint())
+	case req.Op == reqJoinGame || req.Op == reqLeaveGame:
+	default:
+		g.history.Save(g.checkpoint())
+	}
+}
+
+func (g *gameState) CanUndo() bool {
+	return g.history.CanUndo()
+}
+
+func (g *gameState) Undo(players []*games.Client) {
+	cp, ok := g.history.Undo()
+	if !ok {
+		return
+	}
+
+	// Whoever left since the checkpoint is still gone (and whoever came back is still
+	// here)
+	for i := range cp.hands {
+		cp.hands[i].status = g.hands[i].status
+	}
+
+	g.hands = cp.hands
+	g.phase = cp.phase
+	g.nplayers = cp.nplayers
+	g.turn = cp.turn
+	g.pcards = cp.pcards
+	g.bid = cp.bid
+	g.bidder = cp.bidder
+	g.passed = cp.passed
+	g.taker = cp.taker
+	g.winner = cp.winner
+
+	g.skipLeftTurn()
+	g.broadcastFullState(players)
+}
@@ -0,0 +1,66 @@
+package games
+
+import (
+	"github.com/google/uuid"
+	"github.com/samclaus/games/protocol"
+)
+
+// This file contains undoing the last move in the current game, for games that support
+// it (see Undoable). The host can undo on their own, while anybody else's request counts
+// as a vote, and a majority of members have to vote for it. Votes are about the last
+// move, so they are cleared whenever the game's Router accepts another request.
+
+// voteUndo undoes the last move in the current game, or votes to if the member isn't
+// the host. Nothing can be undone while the game is paused.
+func (r *room) voteUndo(src *Client) {
+	u, ok := r.currentGame.(Undoable)
+	if !ok || r.paused {
+		return
+	}
+
+	canUndo := false
+	r.callGame("CanUndo", src, nil, func() { canUndo = u.CanUndo() })
+	if !canUndo {
+		return
+	}
+
+	if src.ID != r.host {
+		if r.undoVotes == nil {
+			r.undoVotes = make(map[uuid.UUID]bool)
+		}
+		r.undoVotes[src.ID] = true
+
+		if !r.majority(r.undoVotes) {
+			r.broadcastState(r.undoVotesState(), false)
+			return
+		}
+	}
+
+	r.clearUndoVotes()
+	r.postNote(protocol.ChatSystem, src.ID, src.Name+" undid the last move in "+r.currentGameID)
+	r.callGame("Undo", src, nil, func() { u.Undo(r.members) })
+}
+
+func (r *room) undoVotesState() *protocol.SetUndoVotesState {
+	votes := make([]uuid.UUID, 0, len(r.undoVotes))
+	for id := range r.undoVotes {
+		votes = append(votes, id)
+	}
+	return &protocol.SetUndoVotesState{Votes: votes}
+}
+
+// clearUndoVotes forgets every vote to undo, if there are any.
+func (r *room) clearUndoVotes() {
+	if len(r.undoVotes) > 0 {
+		r.undoVotes = nil
+		r.broadcastState(r.undoVotesState(), false)
+	}
+}
+
+// forgetUndoVote takes back the vote of a member who left the room, if they cast one.
+func (r *room) forgetUndoVote(c *Client) {
+	if r.undoVotes[c.ID] {
+		delete(r.undoVotes, c.ID)
+		r.broadcastState(r.undoVotesState(), false)
+	}
+}
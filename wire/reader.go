@@ -0,0 +1,164 @@
+package wire
+
+import (
+	"encoding/binary"
+
+	"github.com/google/uuid"
+)
+
+// Reader consumes values from the front of a byte slice. Once it runs into an error,
+// every value read after that is the zero value, so callers only need to check Err (or
+// Done) after reading everything.
+type Reader struct {
+	buf    []byte
+	varint bool
+	err    error
+}
+
+// NewReader returns a Reader for msg which expects 1-byte length prefixes.
+func NewReader(msg []byte) Reader {
+	return Reader{buf: msg}
+}
+
+// NewVarintReader returns a Reader for msg which expects varint length prefixes.
+func NewVarintReader(msg []byte) Reader {
+	return Reader{buf: msg, varint: true}
+}
+
+// Len is the number of bytes left to read.
+func (r *Reader) Len() int {
+	return len(r.buf)
+}
+
+// Err returns the first error the reader ran into, if any.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Fail records err as the reader's error, unless it already has one. This lets callers
+// treat values they don't like the same as a malformed message.
+func (r *Reader) Fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Done returns the reader's error, or ErrTrailing if there is anything left to read.
+// Call it after reading the last field of a message.
+func (r *Reader) Done() error {
+	if r.err == nil && len(r.buf) > 0 {
+		r.err = ErrTrailing
+	}
+	return r.err
+}
+
+func (r *Reader) take(n int) ([]byte, bool) {
+	if r.err != nil {
+		return nil, false
+	}
+	if n < 0 || len(r.buf) < n {
+		r.err = ErrTruncated
+		return nil, false
+	}
+	b := r.buf[:n:n]
+	r.buf = r.buf[n:]
+	return b, true
+}
+
+func (r *Reader) U8() uint8 {
+	if b, ok := r.take(1); ok {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *Reader) U16() uint16 {
+	if b, ok := r.take(2); ok {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *Reader) U32() uint32 {
+	if b, ok := r.take(4); ok {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *Reader) U64() uint64 {
+	if b, ok := r.take(8); ok {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// Bool reads a byte, which is true if it is nonzero.
+func (r *Reader) Bool() bool {
+	return r.U8() != 0
+}
+
+func (r *Reader) UUID() (v uuid.UUID) {
+	if b, ok := r.take(16); ok {
+		copy(v[:], b)
+	}
+	return v
+}
+
+// Str reads a length-prefixed string.
+func (r *Reader) Str() string {
+	return string(r.ByteSlice())
+}
+
+// ByteSlice reads a length-prefixed byte slice. The result points into the message, so
+// copy it if it needs to outlive the message.
+func (r *Reader) ByteSlice() []byte {
+	if b, ok := r.take(r.length()); ok {
+		return b
+	}
+	return nil
+}
+
+// Raw reads n bytes. The result points into the message, so copy it if it needs to
+// outlive the message.
+func (r *Reader) Raw(n int) []byte {
+	if b, ok := r.take(n); ok {
+		return b
+	}
+	return nil
+}
+
+// Tail reads everything left in the message, which may be nothing. The result points
+// into the message, so copy it if it needs to outlive the message.
+func (r *Reader) Tail() []byte {
+	return r.Raw(len(r.buf))
+}
+
+// Bitset reads len(bits) bits into bits.
+func (r *Reader) Bitset(bits []bool) {
+	b, ok := r.take(bitsetLen(len(bits)))
+
+	for i := range bits {
+		bits[i] = ok && b[i/8]&(1<<(i%8)) != 0
+	}
+}
+
+func (r *Reader) length() int {
+	if r.err != nil {
+		return 0
+	}
+	if !r.varint {
+		return int(r.U8())
+	}
+
+	n, size := binary.Uvarint(r.buf)
+	if size <= 0 || n > uint64(len(r.buf)-size) {
+		// Either the varint itself or whatever it is the length of got cut off (or
+		// the varint is absurdly long, which is no different as far as we care)
+		r.err = ErrTruncated
+		return 0
+	}
+
+	r.buf = r.buf[size:]
+	return int(n)
+}
@@ -0,0 +1,46 @@
+// Package wire implements reading and writing the primitives that binary messages are
+// built out of, for the room protocol as well as for games:
+//
+//   - integers, which are big endian
+//   - UUIDs, which are 16 raw bytes
+//   - strings and byte slices, which are prefixed with their length: 1 byte by default,
+//     or a varint for readers/writers made with NewVarintReader/NewVarintWriter
+//   - bitsets, which are packed 8 bits to a byte, least significant bit first
+//
+// Writers never fail. Readers remember the first error they run into (which is almost
+// always ErrTruncated) and return zero values from then on, so a request can be decoded
+// in one go and then checked for errors once, with Done.
+package wire
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// MaxShortLen is the longest string or byte slice that can be written with a 1-byte
+// length prefix. Writers cut anything longer short rather than corrupting the message.
+const MaxShortLen = 255
+
+var (
+	// ErrTruncated means a message ended before everything was read from it.
+	ErrTruncated = errors.New("wire: message truncated")
+	// ErrTrailing means there was still something left after reading everything
+	// expected from a message.
+	ErrTrailing = errors.New("wire: trailing bytes after message")
+)
+
+// bitsetLen is the number of bytes used by a bitset of n bits.
+func bitsetLen(n int) int {
+	return (n + 7) / 8
+}
+
+// truncateUTF8 cuts s down to at most n bytes without splitting a UTF-8 character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,155 @@
+package wire
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRoundTrip(t *testing.T) {
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	bits := []bool{true, false, true, true, false, false, false, false, true}
+
+	for _, varint := range []bool{false, true} {
+		name := "short"
+		w, newReader := NewWriter(nil), NewReader
+		if varint {
+			name = "varint"
+			w, newReader = NewVarintWriter(nil), NewVarintReader
+		}
+
+		t.Run(name, func(t *testing.T) {
+			w.U8(0xab)
+			w.U16(0xabcd)
+			w.U32(0xdeadbeef)
+			w.U64(0x0123456789abcdef)
+			w.Bool(true)
+			w.Bool(false)
+			w.UUID(id)
+			w.Str("")
+			w.Str("héllo")
+			w.ByteSlice([]byte{1, 2, 3})
+			w.Bitset(bits)
+			w.Raw([]byte{4, 5})
+			w.RawStr("tail")
+
+			r := newReader(w.Bytes())
+			gotBits := make([]bool, len(bits))
+
+			checks := []struct {
+				name      string
+				got, want any
+			}{
+				{"U8", r.U8(), uint8(0xab)},
+				{"U16", r.U16(), uint16(0xabcd)},
+				{"U32", r.U32(), uint32(0xdeadbeef)},
+				{"U64", r.U64(), uint64(0x0123456789abcdef)},
+				{"Bool", r.Bool(), true},
+				{"Bool", r.Bool(), false},
+				{"UUID", r.UUID(), id},
+				{"Str", r.Str(), ""},
+				{"Str", r.Str(), "héllo"},
+				{"ByteSlice", string(r.ByteSlice()), "\x01\x02\x03"},
+				{"Bitset", func() string { r.Bitset(gotBits); return bitString(gotBits) }(), bitString(bits)},
+				{"Raw", string(r.Raw(2)), "\x04\x05"},
+				{"Tail", string(r.Tail()), "tail"},
+			}
+
+			for _, c := range checks {
+				if c.got != c.want {
+					t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+				}
+			}
+			if err := r.Done(); err != nil {
+				t.Errorf("Done = %v", err)
+			}
+		})
+	}
+}
+
+func bitString(bits []bool) string {
+	var sb strings.Builder
+	for _, b := range bits {
+		if b {
+			sb.WriteByte('1')
+		} else {
+			sb.WriteByte('0')
+		}
+	}
+	return sb.String()
+}
+
+func TestLongStrings(t *testing.T) {
+	tests := []struct {
+		name   string
+		varint bool
+		str    string
+		want   string
+	}{
+		{name: "short fits", str: strings.Repeat("a", MaxShortLen), want: strings.Repeat("a", MaxShortLen)},
+		{name: "short cut", str: strings.Repeat("a", 300), want: strings.Repeat("a", MaxShortLen)},
+		// "é" is 2 bytes, so the last whole one ends at byte 254
+		{name: "short cut at character", str: strings.Repeat("é", 200), want: strings.Repeat("é", 127)},
+		{name: "varint 300", varint: true, str: strings.Repeat("a", 300), want: strings.Repeat("a", 300)},
+		{name: "varint 70000", varint: true, str: strings.Repeat("a", 70000), want: strings.Repeat("a", 70000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, newReader := NewWriter(nil), NewReader
+			if tt.varint {
+				w, newReader = NewVarintWriter(nil), NewVarintReader
+			}
+
+			w.Str(tt.str)
+			w.U8(42) // make sure the length didn't eat into the next field
+
+			r := newReader(w.Bytes())
+			if got := r.Str(); got != tt.want {
+				t.Errorf("read %d bytes, want %d", len(got), len(tt.want))
+			}
+			if got := r.U8(); got != 42 {
+				t.Errorf("next field = %d, want 42", got)
+			}
+			if err := r.Done(); err != nil {
+				t.Errorf("Done = %v", err)
+			}
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		varint bool
+		msg    []byte
+		read   func(r *Reader)
+		want   error
+	}{
+		{name: "short U32", msg: []byte{1, 2, 3}, read: func(r *Reader) { r.U32() }, want: ErrTruncated},
+		{name: "short UUID", msg: make([]byte, 15), read: func(r *Reader) { r.UUID() }, want: ErrTruncated},
+		{name: "string cut off", msg: []byte{5, 'a', 'b'}, read: func(r *Reader) { r.Str() }, want: ErrTruncated},
+		{name: "varint string cut off", varint: true, msg: []byte{5, 'a', 'b'}, read: func(r *Reader) { r.Str() }, want: ErrTruncated},
+		{name: "varint cut off", varint: true, msg: []byte{0x80}, read: func(r *Reader) { r.Str() }, want: ErrTruncated},
+		{name: "huge varint", varint: true, msg: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, read: func(r *Reader) { r.Str() }, want: ErrTruncated},
+		{name: "short bitset", msg: []byte{0xff}, read: func(r *Reader) { r.Bitset(make([]bool, 9)) }, want: ErrTruncated},
+		{name: "trailing", msg: []byte{1, 2}, read: func(r *Reader) { r.U8() }, want: ErrTrailing},
+		{name: "first error sticks", msg: []byte{1}, read: func(r *Reader) { r.U16(); r.U8() }, want: ErrTruncated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(tt.msg)
+			if tt.varint {
+				r = NewVarintReader(tt.msg)
+			}
+
+			tt.read(&r)
+			if err := r.Done(); !errors.Is(err, tt.want) {
+				t.Errorf("Done = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package wire
+
+import (
+	"encoding/binary"
+
+	"github.com/google/uuid"
+)
+
+// Writer appends values to a byte slice. The zero value is ready to use, and uses 1-byte
+// length prefixes.
+type Writer struct {
+	buf    []byte
+	varint bool
+}
+
+// NewWriter returns a Writer which appends to dst and uses 1-byte length prefixes.
+func NewWriter(dst []byte) Writer {
+	return Writer{buf: dst}
+}
+
+// NewVarintWriter returns a Writer which appends to dst and uses varint length prefixes.
+func NewVarintWriter(dst []byte) Writer {
+	return Writer{buf: dst, varint: true}
+}
+
+// Bytes returns everything written so far, including whatever the writer was created
+// with.
+func (w *Writer) Bytes() []byte {
+	return w.buf
+}
+
+func (w *Writer) U8(v uint8) {
+	w.buf = append(w.buf, v)
+}
+
+func (w *Writer) U16(v uint16) {
+	w.buf = binary.BigEndian.AppendUint16(w.buf, v)
+}
+
+func (w *Writer) U32(v uint32) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+}
+
+func (w *Writer) U64(v uint64) {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, v)
+}
+
+// Bool writes 1 for true and 0 for false.
+func (w *Writer) Bool(v bool) {
+	if v {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *Writer) UUID(v uuid.UUID) {
+	w.buf = append(w.buf, v[:]...)
+}
+
+// Str writes a length-prefixed string. With 1-byte length prefixes, strings longer than
+// MaxShortLen are cut short, at a UTF-8 character boundary.
+func (w *Writer) Str(s string) {
+	if !w.varint {
+		s = truncateUTF8(s, MaxShortLen)
+	}
+	w.length(len(s))
+	w.buf = append(w.buf, s...)
+}
+
+// ByteSlice writes a length-prefixed byte slice. With 1-byte length prefixes, slices
+// longer than MaxShortLen are cut short.
+func (w *Writer) ByteSlice(b []byte) {
+	if !w.varint && len(b) > MaxShortLen {
+		b = b[:MaxShortLen]
+	}
+	w.length(len(b))
+	w.buf = append(w.buf, b...)
+}
+
+// Raw writes bytes without a length prefix, which only makes sense for the last field
+// of a message or for data whose length the reader already knows.
+func (w *Writer) Raw(b []byte) {
+	w.buf = append(w.buf, b...)
+}
+
+// RawStr is just like Raw, but for a string.
+func (w *Writer) RawStr(s string) {
+	w.buf = append(w.buf, s...)
+}
+
+// Bitset writes bits packed into bytes, without a length prefix, so the reader must know
+// how many bits there are.
+func (w *Writer) Bitset(bits []bool) {
+	n := len(w.buf)
+	w.buf = append(w.buf, make([]byte, bitsetLen(len(bits)))...)
+
+	for i, set := range bits {
+		if set {
+			w.buf[n+i/8] |= 1 << (i % 8)
+		}
+	}
+}
+
+func (w *Writer) length(n int) {
+	if w.varint {
+		w.buf = binary.AppendUvarint(w.buf, uint64(n))
+	} else {
+		w.buf = append(w.buf, byte(n))
+	}
+}